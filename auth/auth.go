@@ -1,77 +1,92 @@
 package auth
 
 import (
-	"crypto/rsa"
-	"fmt"
-	"io/ioutil"
-	"log"
+	"errors"
 	"net/http"
 	"time"
 
 	jwt "github.com/dgrijalva/jwt-go"
-	"github.com/dgrijalva/jwt-go/request"
 )
 
 type Auth interface {
 	Validate(string) bool
 }
 
+const (
+	MFAStagePending = "pending"
+	MFAStageEnroll  = "enroll"
+	mfaTokenTTL     = 5 * time.Minute
+)
+
+// Identity is the authenticated user as carried in the token claims.
+// MFA is set on the short lived tokens issued while a login still waits for
+// the second factor. SessionID is the jti claim of a full token. APIKeyID
+// and Scopes are set when the caller used an API key instead of a token.
+type Identity struct {
+	ID        int64    `json:"id"`
+	Email     string   `json:"email"`
+	IsAdmin   bool     `json:"is_admin"`
+	MFA       string   `json:"-"`
+	SessionID string   `json:"-"`
+	APIKeyID  int64    `json:"-"`
+	Scopes    []string `json:"-"`
+}
+
 type Jwt struct {
-	PrivateKeyPath string
-	PublicKeyPath  string
+	Keys     *KeyManager
+	APIKeys  APIKeyStore
+	Sessions SessionStore
+	TTL      time.Duration
+}
+
+func (j *Jwt) CreateToken(identity *Identity) (string, error) {
+	return j.sign(identity, j.GetTTL(), nil)
 }
 
-func (j *Jwt) CreateToken(ID int) (string, error) {
+// CreateMFAToken issues a token that is only accepted by the routes that
+// complete a login with a second factor.
+func (j *Jwt) CreateMFAToken(identity *Identity, stage string) (string, error) {
+	return j.sign(identity, mfaTokenTTL, jwt.MapClaims{"mfa": stage})
+}
+
+func (j *Jwt) sign(identity *Identity, ttl time.Duration, extra jwt.MapClaims) (string, error) {
+	key, err := j.Keys.Signing()
+	if err != nil {
+		return "", err
+	}
 	token := jwt.New(jwt.SigningMethodRS256)
+	token.Header["kid"] = key.ID
 	claims := make(jwt.MapClaims)
-	claims["exp"] = time.Now().Add(time.Hour * time.Duration(1)).Unix()
+	claims["exp"] = time.Now().Add(ttl).Unix()
 	claims["iat"] = time.Now().Unix()
-	claims["id"] = ID
+	claims["id"] = identity.ID
+	claims["email"] = identity.Email
+	claims["admin"] = identity.IsAdmin
+	if identity.SessionID != "" {
+		claims["jti"] = identity.SessionID
+	}
+	for k, v := range extra {
+		claims[k] = v
+	}
 	token.Claims = claims
-	return token.SignedString(j.GetPrivateKey())
+	return token.SignedString(key.Private)
 }
 
-func (j *Jwt) GetPrivateKey() *rsa.PrivateKey {
-	signBytes, err := ioutil.ReadFile(j.PrivateKeyPath)
-	if err != nil {
-		log.Fatal(err)
-	}
-	signKey, err := jwt.ParseRSAPrivateKeyFromPEM(signBytes)
-	if err != nil {
-		log.Fatal(err)
+func (j *Jwt) GetTTL() time.Duration {
+	if j.TTL == 0 {
+		return time.Hour
 	}
-	return signKey
+	return j.TTL
 }
 
-func (j *Jwt) GetPublicKey() *rsa.PublicKey {
-	verifyBytes, err := ioutil.ReadFile(j.PublicKeyPath)
-	if err != nil {
-		log.Fatal(err)
+func (j *Jwt) keyFunc(token *jwt.Token) (interface{}, error) {
+	if _, ok := token.Method.(*jwt.SigningMethodRSA); !ok {
+		return nil, errors.New("unexpected signing method")
 	}
-	verifyKey, err := jwt.ParseRSAPublicKeyFromPEM(verifyBytes)
-	if err != nil {
-		log.Fatal(err)
-	}
-	return verifyKey
+	kid, _ := token.Header["kid"].(string)
+	return j.Keys.Verifying(kid)
 }
 
 func (j *Jwt) Validate(w http.ResponseWriter, r *http.Request, next http.HandlerFunc) {
-
-	token, err := request.ParseFromRequest(r, request.AuthorizationHeaderExtractor,
-		func(token *jwt.Token) (interface{}, error) {
-			return j.GetPublicKey(), nil
-		})
-
-	if err == nil {
-		if token.Valid {
-			next(w, r)
-		} else {
-			w.WriteHeader(http.StatusUnauthorized)
-			fmt.Fprint(w, "Token is not valid")
-		}
-	} else {
-		w.WriteHeader(http.StatusUnauthorized)
-		fmt.Fprint(w, "Unauthorized access to this resource")
-	}
-
+	j.Require(Authenticated)(w, r, next)
 }
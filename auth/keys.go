@@ -0,0 +1,201 @@
+package auth
+
+import (
+	"crypto/rsa"
+	"encoding/base64"
+	"errors"
+	"io/ioutil"
+	"math/big"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	jwt "github.com/dgrijalva/jwt-go"
+)
+
+var (
+	ErrNoSigningKey = errors.New("no signing key available")
+	ErrUnknownKey   = errors.New("unknown or retired signing key")
+)
+
+type Key struct {
+	ID      string
+	Private *rsa.PrivateKey
+	Public  *rsa.PublicKey
+	Retired bool
+	ModTime time.Time
+}
+
+// KeyManager caches the RSA keys found in Dir. A key is named after its
+// file: "<kid>.key" holds a private key, "<kid>.key.pub" a public key that
+// can only be used for verification. Tokens are signed with Active, or the
+// newest private key when Active is empty. Retired keys are neither used nor
+// published.
+type KeyManager struct {
+	Dir     string
+	Active  string
+	Retired []string
+
+	mu     sync.RWMutex
+	keys   map[string]*Key
+	active *Key
+}
+
+func NewKeyManager(dir string, active string, retired []string) (*KeyManager, error) {
+	km := &KeyManager{Dir: dir, Active: active, Retired: retired}
+	return km, km.Load()
+}
+
+// Load (re)reads the key directory. The cached keys are only replaced when
+// the whole directory loads successfully.
+func (km *KeyManager) Load() error {
+	files, err := ioutil.ReadDir(km.Dir)
+	if err != nil {
+		return err
+	}
+
+	retired := make(map[string]bool)
+	for _, kid := range km.Retired {
+		retired[kid] = true
+	}
+
+	keys := make(map[string]*Key)
+	for _, file := range files {
+		if file.IsDir() {
+			continue
+		}
+		name := file.Name()
+		path := filepath.Join(km.Dir, name)
+
+		switch {
+		case strings.HasSuffix(name, ".key"):
+			kid := strings.TrimSuffix(name, ".key")
+			pem, err := ioutil.ReadFile(path)
+			if err != nil {
+				return err
+			}
+			private, err := jwt.ParseRSAPrivateKeyFromPEM(pem)
+			if err != nil {
+				return errors.New(name + ": " + err.Error())
+			}
+			keys[kid] = &Key{ID: kid, Private: private, Public: &private.PublicKey, Retired: retired[kid], ModTime: file.ModTime()}
+
+		case strings.HasSuffix(name, ".key.pub"):
+			kid := strings.TrimSuffix(name, ".key.pub")
+			if _, ok := keys[kid]; ok {
+				continue
+			}
+			pem, err := ioutil.ReadFile(path)
+			if err != nil {
+				return err
+			}
+			public, err := jwt.ParseRSAPublicKeyFromPEM(pem)
+			if err != nil {
+				return errors.New(name + ": " + err.Error())
+			}
+			keys[kid] = &Key{ID: kid, Public: public, Retired: retired[kid], ModTime: file.ModTime()}
+		}
+	}
+
+	active, err := pickActive(keys, km.Active)
+	if err != nil {
+		return err
+	}
+
+	km.mu.Lock()
+	km.keys = keys
+	km.active = active
+	km.mu.Unlock()
+	return nil
+}
+
+func pickActive(keys map[string]*Key, kid string) (*Key, error) {
+	if kid != "" {
+		key, ok := keys[kid]
+		if !ok || key.Private == nil || key.Retired {
+			return nil, errors.New("active key " + kid + " has no usable private key")
+		}
+		return key, nil
+	}
+
+	var active *Key
+	for _, key := range keys {
+		if key.Private == nil || key.Retired {
+			continue
+		}
+		if active == nil || key.ModTime.After(active.ModTime) {
+			active = key
+		}
+	}
+	if active == nil {
+		return nil, ErrNoSigningKey
+	}
+	return active, nil
+}
+
+func (km *KeyManager) Signing() (*Key, error) {
+	km.mu.RLock()
+	defer km.mu.RUnlock()
+	if km.active == nil {
+		return nil, ErrNoSigningKey
+	}
+	return km.active, nil
+}
+
+// Verifying returns the public key for kid. Tokens without a kid were issued
+// before key rotation and are checked against the active key.
+func (km *KeyManager) Verifying(kid string) (*rsa.PublicKey, error) {
+	if kid == "" {
+		key, err := km.Signing()
+		if err != nil {
+			return nil, err
+		}
+		return key.Public, nil
+	}
+
+	km.mu.RLock()
+	defer km.mu.RUnlock()
+	key, ok := km.keys[kid]
+	if !ok || key.Retired {
+		return nil, ErrUnknownKey
+	}
+	return key.Public, nil
+}
+
+type JWK struct {
+	Kty string `json:"kty"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+}
+
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+// JWKS lists the public part of every key that still verifies tokens.
+func (km *KeyManager) JWKS() *JWKS {
+	km.mu.RLock()
+	defer km.mu.RUnlock()
+
+	set := &JWKS{Keys: []JWK{}}
+	for _, key := range km.keys {
+		if key.Retired {
+			continue
+		}
+		set.Keys = append(set.Keys, JWK{
+			Kty: "RSA",
+			Use: "sig",
+			Alg: "RS256",
+			Kid: key.ID,
+			N:   base64.RawURLEncoding.EncodeToString(key.Public.N.Bytes()),
+			E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.Public.E)).Bytes()),
+		})
+	}
+	sort.Slice(set.Keys, func(i, k int) bool { return set.Keys[i].Kid < set.Keys[k].Kid })
+	return set
+}
@@ -0,0 +1,126 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+var (
+	ErrLinkExpired      = errors.New("the link has expired")
+	ErrInvalidSignature = errors.New("the link signature is invalid")
+	ErrLinkBound        = errors.New("the link was made for another user")
+)
+
+// MediaCookie is the cookie user bound links are checked against, see
+// UserCookie.
+const MediaCookie = "media_user"
+
+// mediaUserPath is signed into user cookies in place of a path, links
+// always have one starting with a slash so neither passes for the other.
+const mediaUserPath = "user"
+
+// MediaSigner signs links to media files with HMAC-SHA256. Links carry the
+// kid of the key that signed them: new links are signed with Active while
+// every key in Keys still verifies, so a key is rotated by adding a new one,
+// making it active and dropping the old one once its links have expired.
+type MediaSigner struct {
+	Keys   map[string][]byte
+	Active string
+	TTL    time.Duration
+	// BindUser signs the user links to enrolled content were made for into
+	// them, they are then only served along with that user's cookie, see
+	// UserCookie.
+	BindUser bool
+}
+
+// MediaClaims is what a verified link grants.
+type MediaClaims struct {
+	UserID    *int64
+	ExpiresAt time.Time
+}
+
+func NewMediaSigner(keys map[string][]byte, active string, ttl time.Duration) (*MediaSigner, error) {
+	if _, ok := keys[active]; !ok {
+		return nil, ErrNoSigningKey
+	}
+	return &MediaSigner{Keys: keys, Active: active, TTL: ttl}, nil
+}
+
+// Sign returns path with a query allowing it to be fetched until the TTL
+// runs out, carrying userID when it is not nil.
+func (s *MediaSigner) Sign(path string, userID *int64) string {
+	query := url.Values{}
+	query.Set("expires", strconv.FormatInt(time.Now().Add(s.TTL).Unix(), 10))
+	query.Set("kid", s.Active)
+	if userID != nil {
+		query.Set("uid", strconv.FormatInt(*userID, 10))
+	}
+	query.Set("sig", mediaSignature(s.Keys[s.Active], path, query))
+	return path + "?" + query.Encode()
+}
+
+func (s *MediaSigner) Verify(path string, query url.Values) (*MediaClaims, error) {
+	key, ok := s.Keys[query.Get("kid")]
+	if !ok {
+		return nil, ErrUnknownKey
+	}
+	if !hmac.Equal([]byte(query.Get("sig")), []byte(mediaSignature(key, path, query))) {
+		return nil, ErrInvalidSignature
+	}
+
+	expires, err := strconv.ParseInt(query.Get("expires"), 10, 64)
+	if err != nil {
+		return nil, ErrInvalidSignature
+	}
+	claims := &MediaClaims{ExpiresAt: time.Unix(expires, 0)}
+	if time.Now().After(claims.ExpiresAt) {
+		return nil, ErrLinkExpired
+	}
+	if uid := query.Get("uid"); uid != "" {
+		userID, err := strconv.ParseInt(uid, 10, 64)
+		if err != nil {
+			return nil, ErrInvalidSignature
+		}
+		claims.UserID = &userID
+	}
+	return claims, nil
+}
+
+// UserCookie is the value of the cookie that proves which user follows a
+// link. It is signed like a link and expires along with the links it is
+// handed out with.
+func (s *MediaSigner) UserCookie(userID int64) string {
+	query := url.Values{}
+	query.Set("expires", strconv.FormatInt(time.Now().Add(s.TTL).Unix(), 10))
+	query.Set("kid", s.Active)
+	query.Set("uid", strconv.FormatInt(userID, 10))
+	query.Set("sig", mediaSignature(s.Keys[s.Active], mediaUserPath, query))
+	return query.Encode()
+}
+
+// VerifyUser returns the user a cookie made by UserCookie was signed for.
+func (s *MediaSigner) VerifyUser(value string) (int64, error) {
+	query, err := url.ParseQuery(value)
+	if err != nil {
+		return 0, ErrInvalidSignature
+	}
+	claims, err := s.Verify(mediaUserPath, query)
+	if err != nil {
+		return 0, err
+	}
+	if claims.UserID == nil {
+		return 0, ErrInvalidSignature
+	}
+	return *claims.UserID, nil
+}
+
+func mediaSignature(key []byte, path string, query url.Values) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(query.Get("kid") + "\n" + path + "\n" + query.Get("expires") + "\n" + query.Get("uid")))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,181 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	jwt "github.com/dgrijalva/jwt-go"
+	"github.com/dgrijalva/jwt-go/request"
+)
+
+type Role int
+
+const (
+	Anonymous Role = iota
+	Authenticated
+	Admin
+	// MFAPending only accepts the token issued by a login that still needs
+	// its second factor.
+	MFAPending
+	// MFAEnrollment accepts a full token or the token of an admin who has
+	// to enroll before finishing the login.
+	MFAEnrollment
+)
+
+const (
+	APIKeyHeader = "X-API-Key"
+	ScopeRead    = "read"
+	ScopeWrite   = "write"
+)
+
+// SessionStore tells whether the session a token was issued for is still active.
+type SessionStore interface {
+	SessionActive(ID string) (bool, error)
+}
+
+// APIKeyStore resolves a personal API key to the identity of its owner.
+type APIKeyStore interface {
+	AuthenticateAPIKey(key string) (*Identity, error)
+}
+
+type contextKey int
+
+const identityKey contextKey = 0
+
+func NewContext(ctx context.Context, identity *Identity) context.Context {
+	return context.WithValue(ctx, identityKey, identity)
+}
+
+// FromContext returns the identity stored by Require, if the request carried a valid token.
+func FromContext(ctx context.Context) (*Identity, bool) {
+	identity, ok := ctx.Value(identityKey).(*Identity)
+	return identity, ok
+}
+
+// Require returns a negroni middleware that reads the token claims into
+// the request context and rejects the request unless the caller holds role.
+// A token that is present but invalid is rejected even on anonymous routes.
+func (j *Jwt) Require(role Role) func(http.ResponseWriter, *http.Request, http.HandlerFunc) {
+	return func(w http.ResponseWriter, r *http.Request, next http.HandlerFunc) {
+		identity, err := j.identify(r)
+		if err != nil {
+			writeError(w, http.StatusUnauthorized, err.Error())
+			return
+		}
+
+		switch {
+		case role == MFAPending:
+			if identity == nil || identity.MFA != MFAStagePending {
+				writeError(w, http.StatusUnauthorized, "A pending multi-factor token is required")
+				return
+			}
+		case role == MFAEnrollment:
+			if identity == nil || (identity.MFA != "" && identity.MFA != MFAStageEnroll) {
+				writeError(w, http.StatusUnauthorized, "Unauthorized access to this resource")
+				return
+			}
+		case identity != nil && identity.MFA != "":
+			if role != Anonymous {
+				writeError(w, http.StatusUnauthorized, "Multi-factor authentication is not complete")
+				return
+			}
+			identity = nil
+		}
+
+		if identity == nil && role != Anonymous {
+			writeError(w, http.StatusUnauthorized, "Unauthorized access to this resource")
+			return
+		}
+		if role == Admin && !identity.IsAdmin {
+			writeError(w, http.StatusForbidden, "This resource requires administrator privileges")
+			return
+		}
+		if identity != nil && identity.APIKeyID != 0 && !identity.allows(r.Method) {
+			writeError(w, http.StatusForbidden, "The API key is missing the scope required by this resource")
+			return
+		}
+
+		if identity != nil {
+			r = r.WithContext(NewContext(r.Context(), identity))
+		}
+		next(w, r)
+	}
+}
+
+func (j *Jwt) identify(r *http.Request) (*Identity, error) {
+	if key := r.Header.Get(APIKeyHeader); key != "" && j.APIKeys != nil {
+		return j.APIKeys.AuthenticateAPIKey(key)
+	}
+
+	token, err := request.ParseFromRequest(r, request.AuthorizationHeaderExtractor, j.keyFunc)
+	if err == request.ErrNoTokenInRequest {
+		return nil, nil
+	}
+	if err != nil || !token.Valid {
+		return nil, errors.New("Token is not valid")
+	}
+	identity, err := identityFromClaims(token.Claims)
+	if err != nil {
+		return nil, err
+	}
+
+	// tokens waiting for a second factor don't belong to a session yet
+	if identity.MFA == "" && j.Sessions != nil {
+		if identity.SessionID == "" {
+			return nil, errors.New("Token is not valid")
+		}
+		active, err := j.Sessions.SessionActive(identity.SessionID)
+		if err != nil {
+			return nil, err
+		}
+		if !active {
+			return nil, errors.New("Session has been revoked")
+		}
+	}
+	return identity, nil
+}
+
+// allows reports whether the API key scopes cover the request method, read
+// for safe methods and write for everything else.
+func (identity *Identity) allows(method string) bool {
+	needed := ScopeWrite
+	if method == http.MethodGet || method == http.MethodHead {
+		needed = ScopeRead
+	}
+	for _, scope := range identity.Scopes {
+		if scope == needed || scope == ScopeWrite {
+			return true
+		}
+	}
+	return false
+}
+
+func identityFromClaims(c jwt.Claims) (*Identity, error) {
+	claims, ok := c.(jwt.MapClaims)
+	if !ok {
+		return nil, errors.New("Token is not valid")
+	}
+	id, ok := claims["id"].(float64)
+	if !ok {
+		return nil, errors.New("Token is not valid")
+	}
+	identity := &Identity{ID: int64(id)}
+	identity.Email, _ = claims["email"].(string)
+	identity.IsAdmin, _ = claims["admin"].(bool)
+	identity.MFA, _ = claims["mfa"].(string)
+	identity.SessionID, _ = claims["jti"].(string)
+	return identity, nil
+}
+
+func writeError(w http.ResponseWriter, code int, message string) {
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"data":    nil,
+		"message": "",
+		"error":   message,
+		"code":    code,
+	})
+}
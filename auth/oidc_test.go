@@ -0,0 +1,229 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+)
+
+// mockIssuer is a local OpenID provider: it hands out a code for whatever
+// authorization request it is given and redeems it for an ID token signed
+// with key, checking the PKCE verifier.
+type mockIssuer struct {
+	server *httptest.Server
+	key    *rsa.PrivateKey
+	// signer signs the ID tokens, key unless a test swaps it
+	signer *rsa.PrivateKey
+
+	mu    sync.Mutex
+	codes map[string]url.Values
+}
+
+func newMockIssuer(t *testing.T) *mockIssuer {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := &mockIssuer{key: key, signer: key, codes: make(map[string]url.Values)}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", m.discovery)
+	mux.HandleFunc("/jwks", m.jwks)
+	mux.HandleFunc("/token", m.token)
+	// TLS, so the flow only works through OIDC.HTTPClient which trusts it
+	m.server = httptest.NewTLSServer(mux)
+	t.Cleanup(m.server.Close)
+	return m
+}
+
+func (m *mockIssuer) oidc() *OIDC {
+	return &OIDC{
+		Issuer:       m.server.URL,
+		ClientID:     "courses",
+		ClientSecret: "secret",
+		RedirectURL:  "http://localhost:9001/oidc/callback",
+		HTTPClient:   m.server.Client(),
+	}
+}
+
+func (m *mockIssuer) discovery(w http.ResponseWriter, r *http.Request) {
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"issuer":                                m.server.URL,
+		"authorization_endpoint":                m.server.URL + "/authorize",
+		"token_endpoint":                        m.server.URL + "/token",
+		"jwks_uri":                              m.server.URL + "/jwks",
+		"id_token_signing_alg_values_supported": []string{"RS256"},
+	})
+}
+
+func (m *mockIssuer) jwks(w http.ResponseWriter, r *http.Request) {
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"keys": []map[string]string{{
+			"kty": "RSA",
+			"kid": "test",
+			"alg": "RS256",
+			"use": "sig",
+			"n":   base64.RawURLEncoding.EncodeToString(m.key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(m.key.E)).Bytes()),
+		}},
+	})
+}
+
+// authorize stands for the user signing in at the provider, it returns the
+// code the provider redirects back with.
+func (m *mockIssuer) authorize(t *testing.T, authURL string) string {
+	u, err := url.Parse(authURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	code, err := NewToken()
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.mu.Lock()
+	m.codes[code] = u.Query()
+	m.mu.Unlock()
+	return code
+}
+
+func (m *mockIssuer) token(w http.ResponseWriter, r *http.Request) {
+	r.ParseForm()
+	m.mu.Lock()
+	request, ok := m.codes[r.PostForm.Get("code")]
+	delete(m.codes, r.PostForm.Get("code"))
+	m.mu.Unlock()
+	if !ok || PKCEChallenge(r.PostForm.Get("code_verifier")) != request.Get("code_challenge") {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(`{"error":"invalid_grant"}`))
+		return
+	}
+
+	idToken := m.sign(map[string]interface{}{
+		"iss":            m.server.URL,
+		"sub":            "subject-1",
+		"aud":            request.Get("client_id"),
+		"exp":            time.Now().Add(time.Hour).Unix(),
+		"iat":            time.Now().Unix(),
+		"nonce":          request.Get("nonce"),
+		"email":          "ada@example.com",
+		"email_verified": true,
+		"given_name":     "Ada",
+		"family_name":    "Lovelace",
+	})
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"access_token": "access",
+		"token_type":   "Bearer",
+		"expires_in":   3600,
+		"id_token":     idToken,
+	})
+}
+
+func (m *mockIssuer) sign(claims map[string]interface{}) string {
+	header, _ := json.Marshal(map[string]string{"alg": "RS256", "kid": "test", "typ": "JWT"})
+	payload, _ := json.Marshal(claims)
+	signed := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	sum := sha256.Sum256([]byte(signed))
+	signature, _ := rsa.SignPKCS1v15(rand.Reader, m.signer, crypto.SHA256, sum[:])
+	return signed + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+func TestOIDCExchange(t *testing.T) {
+	issuer := newMockIssuer(t)
+	o := issuer.oidc()
+	ctx := context.Background()
+
+	authURL, err := o.AuthCodeURL(ctx, "state-1", "nonce-1", "verifier-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	u, _ := url.Parse(authURL)
+	query := u.Query()
+	if u.Path != "/authorize" || query.Get("state") != "state-1" || query.Get("nonce") != "nonce-1" || query.Get("client_id") != "courses" {
+		t.Errorf("authorization url %s", authURL)
+	}
+	if query.Get("code_challenge") != PKCEChallenge("verifier-1") || query.Get("code_challenge_method") != "S256" {
+		t.Errorf("authorization url without the PKCE challenge: %s", authURL)
+	}
+
+	code := issuer.authorize(t, authURL)
+	claims, err := o.Exchange(ctx, code, "verifier-1", "nonce-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := OIDCClaims{
+		Issuer:        issuer.server.URL,
+		Subject:       "subject-1",
+		Email:         "ada@example.com",
+		EmailVerified: true,
+		GivenName:     "Ada",
+		FamilyName:    "Lovelace",
+	}
+	if *claims != want {
+		t.Errorf("claims = %+v, want %+v", *claims, want)
+	}
+}
+
+func TestOIDCExchangeWrongVerifier(t *testing.T) {
+	issuer := newMockIssuer(t)
+	o := issuer.oidc()
+	authURL, err := o.AuthCodeURL(context.Background(), "state-1", "nonce-1", "verifier-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	code := issuer.authorize(t, authURL)
+	if _, err := o.Exchange(context.Background(), code, "verifier-2", "nonce-1"); err == nil {
+		t.Error("a code was redeemed with another verifier")
+	}
+}
+
+func TestOIDCExchangeNonce(t *testing.T) {
+	issuer := newMockIssuer(t)
+	o := issuer.oidc()
+	authURL, err := o.AuthCodeURL(context.Background(), "state-1", "nonce-1", "verifier-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	code := issuer.authorize(t, authURL)
+	if _, err := o.Exchange(context.Background(), code, "verifier-1", "nonce-2"); err != ErrOIDCNonce {
+		t.Errorf("Exchange with another nonce: %v, want ErrOIDCNonce", err)
+	}
+}
+
+func TestOIDCExchangeUntrustedKey(t *testing.T) {
+	issuer := newMockIssuer(t)
+	other, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	issuer.signer = other
+	o := issuer.oidc()
+	authURL, err := o.AuthCodeURL(context.Background(), "state-1", "nonce-1", "verifier-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	code := issuer.authorize(t, authURL)
+	if _, err := o.Exchange(context.Background(), code, "verifier-1", "nonce-1"); err == nil {
+		t.Error("accepted an ID token signed with a key the issuer doesn't publish")
+	}
+}
+
+func TestOIDCNeedsHTTPClient(t *testing.T) {
+	issuer := newMockIssuer(t)
+	o := issuer.oidc()
+	o.HTTPClient = nil
+	if _, err := o.AuthCodeURL(context.Background(), "state-1", "nonce-1", "verifier-1"); err == nil {
+		t.Error("discovered the issuer without trusting its certificate")
+	}
+}
@@ -3,6 +3,8 @@ package env
 import (
 	"database/sql"
 
+	"github.com/arizanovj/courses/mailer"
+	"github.com/arizanovj/courses/storage"
 	"gopkg.in/doug-martin/goqu.v4"
 )
 
@@ -13,5 +15,8 @@ type Env struct {
 	BaseDir    string
 	ImageDir   string
 	VideoDir   string
+	UploadDir  string
 	AppURL     string
+	Mailer     mailer.Mailer
+	Storage    storage.Storage
 }
@@ -0,0 +1,108 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/arizanovj/courses/auth"
+	"github.com/arizanovj/courses/env"
+	"github.com/arizanovj/courses/model"
+	"github.com/gorilla/mux"
+)
+
+type APIKey struct {
+	Env *env.Env
+}
+
+func (a *APIKey) All(w http.ResponseWriter, r *http.Request) {
+	response := &Response{W: w}
+	identity, _ := auth.FromContext(r.Context())
+
+	apiKey := &model.APIKey{Env: a.Env}
+	keys, err := apiKey.GetForUser(identity.ID)
+	if err != nil {
+		response.Err = err.Error()
+		response.Code = 400
+		response.Json()
+		return
+	}
+
+	response.Code = 200
+	response.Data = keys
+	response.Json()
+}
+
+// Create returns the key in plain text. It is the only time it is shown.
+func (a *APIKey) Create(w http.ResponseWriter, r *http.Request) {
+	response := &Response{W: w}
+	identity, _ := auth.FromContext(r.Context())
+	if identity.APIKeyID != 0 {
+		response.Err = "API keys can't be used to create other API keys"
+		response.Code = 403
+		response.Json()
+		return
+	}
+
+	apiKey := &model.APIKey{Env: a.Env}
+	if err := json.NewDecoder(r.Body).Decode(apiKey); err != nil {
+		response.Err = err.Error()
+		response.Code = 400
+		response.Json()
+		return
+	}
+	apiKey.UserID = identity.ID
+
+	if err := apiKey.Validate(); err != nil {
+		response.Err = err
+		response.Code = 400
+		response.Json()
+		return
+	}
+
+	apiKey, err := apiKey.Create()
+	if err != nil {
+		response.Err = err.Error()
+		response.Code = 400
+		response.Json()
+		return
+	}
+
+	response.Code = 200
+	response.Data = apiKey
+	response.Json()
+}
+
+func (a *APIKey) Delete(w http.ResponseWriter, r *http.Request) {
+	response := &Response{W: w}
+	identity, _ := auth.FromContext(r.Context())
+	vars := mux.Vars(r)
+
+	ID, err := strconv.ParseInt(vars["id"], 10, 64)
+
+	if err != nil {
+		response.Err = err.Error()
+		response.Code = 400
+		response.Json()
+		return
+	}
+
+	apiKey := &model.APIKey{Env: a.Env}
+	err = apiKey.Revoke(identity.ID, ID)
+	if err == model.ErrAPIKeyNotFound {
+		response.Err = err.Error()
+		response.Code = 404
+		response.Json()
+		return
+	}
+	if err != nil {
+		response.Err = err.Error()
+		response.Code = 400
+		response.Json()
+		return
+	}
+
+	response.Code = 200
+	response.Data = ID
+	response.Json()
+}
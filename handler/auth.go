@@ -1,19 +1,51 @@
 package handler
 
 import (
+	"database/sql"
 	"encoding/json"
 	"fmt"
+	"math"
+	"net"
 	"net/http"
+	"strconv"
+	"time"
 
 	"github.com/arizanovj/courses/auth"
 	"github.com/arizanovj/courses/env"
+	"github.com/arizanovj/courses/mailer"
 	"github.com/arizanovj/courses/model"
 )
 
 type Auth struct {
-	Env *env.Env
+	Env             *env.Env
+	Jwt             *auth.Jwt
+	Throttle        *model.LoginThrottle
+	EmailThrottle   *model.EmailThrottle
+	MFA             *model.MFA
+	OIDC            *auth.OIDC
+	RequireAdminMFA bool
+	RefreshTTL      time.Duration
 }
 
+type tokenPair struct {
+	Token        string `json:"token"`
+	RefreshToken string `json:"refresh_token"`
+	ExpiresIn    int64  `json:"expires_in"`
+}
+
+type refreshRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+type emailRequest struct {
+	Email string `json:"email"`
+}
+
+const (
+	emailVerificationTTL = 24 * time.Hour
+	passwordResetTTL     = time.Hour
+)
+
 func (a *Auth) Login(w http.ResponseWriter, r *http.Request) {
 
 	login := model.Login{}
@@ -38,8 +70,39 @@ func (a *Auth) Login(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if err, _ := login.Login(); err != nil {
+	// the throttle fails closed, passwords could be guessed freely without it
+	ip := clientIP(r)
+	wait, err := a.Throttle.Check(login.Email, ip)
+	if err != nil {
 		fmt.Printf("%+v\n", err)
+		response.Err = "login is temporarily unavailable"
+		response.Code = 503
+		response.Json()
+		return
+	}
+	if wait > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+		response.Err = "Too many failed login attempts, try again later"
+		response.Code = 429
+		response.Json()
+		return
+	}
+
+	user, err := login.Login()
+	if err == model.ErrEmailNotVerified {
+		response.Err = err.Error()
+		response.Code = 403
+		response.Json()
+		return
+	}
+	if err == model.ErrInvalidCredentials {
+		if err := a.Throttle.Fail(login.Email, ip); err != nil {
+			fmt.Printf("%+v\n", err)
+			response.Err = "login is temporarily unavailable"
+			response.Code = 503
+			response.Json()
+			return
+		}
 		loginError := make(map[string]interface{})
 		loginError["email|password"] = "Wrong username or password"
 		response.Err = loginError
@@ -47,21 +110,400 @@ func (a *Auth) Login(w http.ResponseWriter, r *http.Request) {
 		response.Json()
 		return
 	}
+	if err != nil {
+		response.Err = err.Error()
+		response.Code = 500
+		response.Json()
+		return
+	}
+
+	if err := a.Throttle.Succeed(login.Email); err != nil {
+		fmt.Printf("%+v\n", err)
+	}
+
+	a.completeLogin(response, r, user)
+
+}
+
+func (a *Auth) Refresh(w http.ResponseWriter, r *http.Request) {
+	response := &Response{W: w}
+	req := refreshRequest{}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.RefreshToken == "" {
+		response.Err = "refresh_token is required"
+		response.Code = 400
+		response.Json()
+		return
+	}
+
+	refreshToken := &model.RefreshToken{Env: a.Env}
+	refreshToken, err := refreshToken.Rotate(req.RefreshToken, a.RefreshTTL)
+	if err != nil {
+		response.Err = err.Error()
+		response.Code = 401
+		response.Json()
+		return
+	}
+
+	user := &model.User{Env: a.Env}
+	user, err = user.GetByID(refreshToken.UserID)
+	if err != nil {
+		response.Err = model.ErrInvalidRefreshToken.Error()
+		response.Code = 401
+		response.Json()
+		return
+	}
+
+	tokens, err := a.issueTokens(user, refreshToken)
+	if err != nil {
+		response.Err = err.Error()
+		response.Code = 500
+		response.Json()
+		return
+	}
+
+	response.Code = 200
+	response.Data = tokens
+	response.Json()
+}
+
+func (a *Auth) Logout(w http.ResponseWriter, r *http.Request) {
+	response := &Response{W: w}
+	req := refreshRequest{}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.RefreshToken == "" {
+		response.Err = "refresh_token is required"
+		response.Code = 400
+		response.Json()
+		return
+	}
 
-	j := &auth.Jwt{
-		PublicKeyPath:  "/home/jovan/.config/courses/jwtRS256.key.pub",
-		PrivateKeyPath: "/home/jovan/.config/courses/jwtRS256.key",
+	refreshToken := &model.RefreshToken{Env: a.Env}
+	if err := refreshToken.Revoke(req.RefreshToken); err != nil && err != model.ErrInvalidRefreshToken {
+		response.Err = err.Error()
+		response.Code = 500
+		response.Json()
+		return
 	}
-	token, _ := j.CreateToken(1)
 
 	response.Code = 200
-	response.Data = token
 	response.Json()
+}
 
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
 }
 
-func (a *Auth) Signup() {
+// completeLogin answers a successful first factor with either an MFA
+// challenge or a new session.
+func (a *Auth) completeLogin(response *Response, r *http.Request, user *model.User) {
+	identity := user.Identity()
+	if user.MFAEnabledAt != nil || (a.RequireAdminMFA && identity.IsAdmin) {
+		stage := auth.MFAStagePending
+		if user.MFAEnabledAt == nil {
+			stage = auth.MFAStageEnroll
+		}
+		token, err := a.Jwt.CreateMFAToken(identity, stage)
+		if err != nil {
+			response.Err = err.Error()
+			response.Code = 500
+			response.Json()
+			return
+		}
+		response.Code = 200
+		response.Data = &mfaChallenge{
+			MFARequired:        true,
+			MFAToken:           token,
+			EnrollmentRequired: stage == auth.MFAStageEnroll,
+		}
+		response.Json()
+		return
+	}
+
+	tokens, err := a.startSession(r, user)
+	if err != nil {
+		response.Err = err.Error()
+		response.Code = 500
+		response.Json()
+		return
+	}
+
+	response.Code = 200
+	response.Data = tokens
+	response.Json()
+}
+
+func (a *Auth) startSession(r *http.Request, user *model.User) (*tokenPair, error) {
+	session := &model.Session{Env: a.Env}
+	session, err := session.Create(user.ID, r.UserAgent(), clientIP(r), a.RefreshTTL)
+	if err != nil {
+		return nil, err
+	}
+	refreshToken := &model.RefreshToken{Env: a.Env}
+	refreshToken, err = refreshToken.Create(session, a.RefreshTTL)
+	if err != nil {
+		return nil, err
+	}
+	return a.issueTokens(user, refreshToken)
+}
+
+func (a *Auth) issueTokens(user *model.User, refreshToken *model.RefreshToken) (*tokenPair, error) {
+	identity := user.Identity()
+	identity.SessionID = refreshToken.SessionID
+	token, err := a.Jwt.CreateToken(identity)
+	if err != nil {
+		return nil, err
+	}
+	return &tokenPair{
+		Token:        token,
+		RefreshToken: refreshToken.Token,
+		ExpiresIn:    int64(a.Jwt.GetTTL().Seconds()),
+	}, nil
+}
+
+func (a *Auth) Signup(w http.ResponseWriter, r *http.Request) {
+	response := &Response{W: w}
+	signup := &model.Signup{Env: a.Env}
+	if err := json.NewDecoder(r.Body).Decode(signup); err != nil {
+		response.Err = err.Error()
+		response.Code = 400
+		response.Json()
+		return
+	}
+
+	if err := signup.Validate(); err != nil {
+		response.Err = err
+		response.Code = 400
+		response.Json()
+		return
+	}
+
+	lastID, err := signup.Register()
+	if err == model.ErrEmailTaken {
+		response.Err = err.Error()
+		response.Code = 409
+		response.Json()
+		return
+	}
+	if err != nil {
+		response.Err = err.Error()
+		response.Code = 400
+		response.Json()
+		return
+	}
+
+	if err := a.sendVerification(lastID, signup.Email); err != nil {
+		fmt.Printf("%+v\n", err)
+		response.Err = "account created but the verification email could not be sent"
+		response.Code = 500
+		response.Json()
+		return
+	}
+
+	response.Code = 200
+	response.Data = lastID
+	response.Message = "Verification email sent"
+	response.Json()
+}
+
+func (a *Auth) VerifyEmail(w http.ResponseWriter, r *http.Request) {
+	response := &Response{W: w}
+	token := r.URL.Query().Get("token")
+	if token == "" {
+		response.Err = "token is required"
+		response.Code = 400
+		response.Json()
+		return
+	}
+
+	userToken := &model.UserToken{Env: a.Env}
+	_, err := userToken.Consume(token, model.TokenEmailVerification, func(tx *sql.Tx, t *model.UserToken) error {
+		user := &model.User{Env: a.Env, ID: t.UserID}
+		return user.MarkEmailVerified(tx)
+	})
+	if err == model.ErrInvalidUserToken {
+		response.Err = err.Error()
+		response.Code = 400
+		response.Json()
+		return
+	}
+	if err != nil {
+		response.Err = err.Error()
+		response.Code = 500
+		response.Json()
+		return
+	}
+
+	response.Code = 200
+	response.Message = "Email verified"
+	response.Json()
+}
+
+// ResendVerification answers the same way, and as fast, whether or not the
+// email is registered, so it can't be used to enumerate accounts.
+func (a *Auth) ResendVerification(w http.ResponseWriter, r *http.Request) {
+	response := &Response{W: w}
+	req := emailRequest{}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Email == "" {
+		response.Err = "email is required"
+		response.Code = 400
+		response.Json()
+		return
+	}
+	if !a.throttleEmail(response, r, req.Email) {
+		return
+	}
+
+	// looked up and sent after answering
+	go func() {
+		user := &model.User{DB: a.Env.DB}
+		user, err := user.FindByEmail(req.Email)
+		if err != nil || user.VerifiedAt != nil {
+			return
+		}
+		userToken := &model.UserToken{Env: a.Env}
+		if err := userToken.Invalidate(user.ID, model.TokenEmailVerification); err != nil {
+			fmt.Printf("%+v\n", err)
+		}
+		if err := a.sendVerification(user.ID, user.Email); err != nil {
+			fmt.Printf("%+v\n", err)
+		}
+	}()
+
+	response.Code = 200
+	response.Message = "If the account exists and is not verified, a verification email has been sent"
+	response.Json()
+}
+
+// ForgotPassword always reports success, without waiting for the email to
+// be sent, so it can't be used to find out which emails are registered.
+func (a *Auth) ForgotPassword(w http.ResponseWriter, r *http.Request) {
+	response := &Response{W: w}
+	req := emailRequest{}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Email == "" {
+		response.Err = "email is required"
+		response.Code = 400
+		response.Json()
+		return
+	}
+	if !a.throttleEmail(response, r, req.Email) {
+		return
+	}
+
+	go func() {
+		user := &model.User{DB: a.Env.DB}
+		user, err := user.FindByEmail(req.Email)
+		if err != nil {
+			return
+		}
+		if err := a.sendPasswordReset(user); err != nil {
+			fmt.Printf("%+v\n", err)
+		}
+	}()
+
+	response.Code = 200
+	response.Message = "If the account exists, a password reset email has been sent"
+	response.Json()
+}
+
+func (a *Auth) ResetPassword(w http.ResponseWriter, r *http.Request) {
+	response := &Response{W: w}
+	reset := &model.PasswordReset{Env: a.Env}
+	if err := json.NewDecoder(r.Body).Decode(reset); err != nil {
+		response.Err = err.Error()
+		response.Code = 400
+		response.Json()
+		return
+	}
+
+	if err := reset.Validate(); err != nil {
+		response.Err = err
+		response.Code = 400
+		response.Json()
+		return
+	}
+
+	userID, err := reset.Reset()
+	if err == model.ErrInvalidUserToken {
+		response.Err = err.Error()
+		response.Code = 400
+		response.Json()
+		return
+	}
+	if err != nil {
+		response.Err = err.Error()
+		response.Code = 500
+		response.Json()
+		return
+	}
+
+	response.Code = 200
+	response.Data = userID
+	response.Message = "Password has been changed"
+	response.Json()
+}
+
+// throttleEmail answers the request itself when the address or the client
+// asked for too many emails lately.
+func (a *Auth) throttleEmail(response *Response, r *http.Request, email string) bool {
+	wait, err := a.EmailThrottle.Allow(email, clientIP(r))
+	if err != nil {
+		response.Err = err.Error()
+		response.Code = 500
+		response.Json()
+		return false
+	}
+	if wait > 0 {
+		response.W.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+		response.Err = "Too many emails requested, try again later"
+		response.Code = 429
+		response.Json()
+		return false
+	}
+	return true
+}
+
+func (a *Auth) sendPasswordReset(user *model.User) error {
+	userToken := &model.UserToken{Env: a.Env}
+	if err := userToken.Invalidate(user.ID, model.TokenPasswordReset); err != nil {
+		return err
+	}
+	userToken, err := userToken.Create(user.ID, model.TokenPasswordReset, passwordResetTTL)
+	if err != nil {
+		return err
+	}
+	return a.Env.Mailer.Send(&mailer.Message{
+		To:      user.Email,
+		Subject: "Reset your password",
+		Body: "Someone asked to reset the password of your account. Use the token below to choose a new one:\n\n" +
+			userToken.Token + "\n\n" +
+			"The token expires in one hour and can be used once. If you didn't ask for this, ignore this email.",
+	})
+}
+
+func (a *Auth) sendVerification(userID int64, email string) error {
+	userToken := &model.UserToken{Env: a.Env}
+	userToken, err := userToken.Create(userID, model.TokenEmailVerification, emailVerificationTTL)
+	if err != nil {
+		return err
+	}
+	return a.Env.Mailer.Send(&mailer.Message{
+		To:      email,
+		Subject: "Verify your email address",
+		Body: "Welcome! Confirm your email address by opening the link below:\n\n" +
+			a.Env.AppURL + "/v1/auth/verify/?token=" + userToken.Token + "\n\n" +
+			"The link expires in 24 hours.",
+	})
+}
 
+// JWKS publishes the token verification keys in the standard JWK Set format
+// rather than the usual response envelope, so other services can consume it.
+func (a *Auth) JWKS(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	json.NewEncoder(w).Encode(a.Jwt.Keys.JWKS())
 }
 
 func (a *Auth) Private(w http.ResponseWriter, r *http.Request) {
@@ -0,0 +1,147 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/arizanovj/courses/env"
+	"github.com/arizanovj/courses/model"
+	"github.com/gorilla/mux"
+)
+
+type Category struct {
+	Env *env.Env
+}
+
+func categoryErrorCode(err error) int {
+	switch err {
+	case model.ErrCategoryNotFound:
+		return 404
+	case model.ErrCategoryCycle:
+		return 422
+	case model.ErrCategoryHasChildren:
+		return 409
+	}
+	return 400
+}
+
+// All returns the category tree, or a flat list with ?flat=true.
+func (a *Category) All(w http.ResponseWriter, r *http.Request) {
+	response := &Response{W: w}
+	category := &model.Category{Env: a.Env}
+
+	var categories []*model.Category
+	var err error
+	if r.URL.Query().Get("flat") == "true" {
+		categories, err = category.GetAll()
+	} else {
+		categories, err = category.Tree()
+	}
+	if err != nil {
+		response.Err = err.Error()
+		response.Code = 400
+		response.Json()
+		return
+	}
+
+	response.Code = 200
+	response.Data = categories
+	response.Json()
+}
+
+func (a *Category) Create(w http.ResponseWriter, r *http.Request) {
+	response := &Response{W: w}
+	category := &model.Category{Env: a.Env}
+	if err := json.NewDecoder(r.Body).Decode(category); err != nil {
+		response.Err = err.Error()
+		response.Code = 400
+		response.Json()
+		return
+	}
+	category.ID = 0
+
+	if err := category.Validate(); err != nil {
+		response.Err = err
+		response.Code = 400
+		response.Json()
+		return
+	}
+
+	lastID, err := category.Create()
+	if err != nil {
+		response.Err = err.Error()
+		response.Code = categoryErrorCode(err)
+		response.Json()
+		return
+	}
+
+	response.Code = 200
+	response.Data = lastID
+	response.Json()
+}
+
+func (a *Category) Update(w http.ResponseWriter, r *http.Request) {
+	response := &Response{W: w}
+	vars := mux.Vars(r)
+
+	ID, err := strconv.ParseInt(vars["id"], 10, 64)
+	if err != nil {
+		response.Err = err.Error()
+		response.Code = 400
+		response.Json()
+		return
+	}
+
+	category := &model.Category{Env: a.Env}
+	if err := json.NewDecoder(r.Body).Decode(category); err != nil {
+		response.Err = err.Error()
+		response.Code = 400
+		response.Json()
+		return
+	}
+	category.ID = ID
+
+	if err := category.Validate(); err != nil {
+		response.Err = err
+		response.Code = 400
+		response.Json()
+		return
+	}
+
+	if err := category.Update(); err != nil {
+		response.Err = err.Error()
+		response.Code = categoryErrorCode(err)
+		response.Json()
+		return
+	}
+
+	response.Code = 200
+	response.Data = ID
+	response.Json()
+}
+
+func (a *Category) Delete(w http.ResponseWriter, r *http.Request) {
+	response := &Response{W: w}
+	vars := mux.Vars(r)
+
+	ID, err := strconv.ParseInt(vars["id"], 10, 64)
+	if err != nil {
+		response.Err = err.Error()
+		response.Code = 400
+		response.Json()
+		return
+	}
+
+	category := &model.Category{Env: a.Env, ID: ID}
+	if err := category.Delete(); err != nil {
+		response.Err = err.Error()
+		response.Code = categoryErrorCode(err)
+		response.Json()
+		return
+	}
+
+	response.Code = 200
+	response.Data = ID
+	response.Json()
+}
@@ -1,11 +1,12 @@
 package handler
 
 import (
+	"database/sql"
 	"encoding/json"
 	"net/http"
-	"os"
 	"strconv"
 
+	"github.com/arizanovj/courses/auth"
 	"github.com/arizanovj/courses/env"
 	"github.com/arizanovj/courses/libs"
 	"github.com/arizanovj/courses/libs/filter"
@@ -15,12 +16,24 @@ import (
 )
 
 type Course struct {
-	Env *env.Env
+	Env   *env.Env
+	Media *auth.MediaSigner
+	// ImageTypes are the MIME types accepted for covers, with the largest
+	// size allowed for each.
+	ImageTypes map[string]int64
 }
 
 func (a *Course) All(w http.ResponseWriter, r *http.Request) {
+	a.list(w, r, &model.Course{Env: a.Env, OnlyPublished: !isAdmin(r)})
+}
+
+// Trash lists what was deleted and not purged yet.
+func (a *Course) Trash(w http.ResponseWriter, r *http.Request) {
+	a.list(w, r, &model.Course{Env: a.Env, Trash: true})
+}
+
+func (a *Course) list(w http.ResponseWriter, r *http.Request, course *model.Course) {
 	response := &Response{W: w}
-	course := &model.Course{Env: a.Env}
 	paginator := &pagination.Paginator{}
 	decoder := schema.NewDecoder()
 	decoder.IgnoreUnknownKeys(true)
@@ -54,8 +67,19 @@ func (a *Course) All(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	facets, err := course.Facets(filter)
+	if err != nil {
+		response.Err = err.Error()
+		response.Code = 400
+		response.Json()
+		return
+	}
+
+	signCovers(a.Env, a.Media, courses)
+
 	response.Code = 200
 	response.Data = courses
+	response.Meta = map[string]interface{}{"facets": facets}
 	response.Json()
 }
 
@@ -75,11 +99,19 @@ func (a *Course) Create(w http.ResponseWriter, r *http.Request) {
 
 	//err = course.Validate()
 
+	if !authorizeInstructor(a.Env, response, r) {
+		return
+	}
+	identity, _ := auth.FromContext(r.Context())
+	if !identity.IsAdmin {
+		course.OwnerID = &identity.ID
+	}
+
 	lastID, err := course.Create()
 
 	if err != nil {
 		response.Err = err.Error()
-		response.Code = 400
+		response.Code = referenceErrorCode(err)
 		response.Json()
 		return
 	}
@@ -103,7 +135,15 @@ func (a *Course) Get(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	course := &model.Course{Env: a.Env}
+	unpublished, err := seesUnpublished(a.Env, r, ID)
+	if err != nil {
+		response.Err = err.Error()
+		response.Code = 400
+		response.Json()
+		return
+	}
+
+	course := &model.Course{Env: a.Env, OnlyPublished: !unpublished}
 	courseData, err := course.GetByID(ID)
 	if err != nil {
 		response.Err = err.Error()
@@ -111,8 +151,25 @@ func (a *Course) Get(w http.ResponseWriter, r *http.Request) {
 		response.Json()
 		return
 	}
-	path := a.Env.AppURL + a.Env.ImageDir + *(course.Cover)
-	course.Cover = &path
+	if courseData.OnlyPublished && !courseData.IsVisible() {
+		response.Err = "there is no such course"
+		response.Code = 404
+		response.Json()
+		return
+	}
+	signCovers(a.Env, a.Media, []*model.Course{courseData})
+
+	if r.URL.Query().Get("include") == "syllabus" {
+		courseData.Syllabus, err = courseData.GetSyllabus()
+		if err != nil {
+			response.Err = err.Error()
+			response.Code = 400
+			response.Json()
+			return
+		}
+		signSyllabus(a.Env, a.Media, w, r, courseData.Syllabus)
+	}
+
 	response.Code = 200
 	response.Data = courseData
 	response.Json()
@@ -131,9 +188,26 @@ func (a *Course) Delete(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	cascade := r.URL.Query().Get("cascade") == "true"
+
+	if !authorizeCourse(a.Env, response, r, ID, true) {
+		return
+	}
+
 	course := &model.Course{Env: a.Env, ID: ID}
-	err = course.Delete()
-	if err != nil {
+	err = course.Delete(cascade)
+	if dependent, ok := err.(*model.DependentVideosError); ok {
+		response.Err = dependent.Error() + ", delete them first or pass cascade=true"
+		response.Data = dependent.Videos
+		response.Code = 409
+		response.Json()
+		return
+	} else if err == sql.ErrNoRows {
+		response.Err = model.ErrCourseNotFound.Error()
+		response.Code = 404
+		response.Json()
+		return
+	} else if err != nil {
 		response.Err = err.Error()
 		response.Code = 400
 		response.Json()
@@ -158,10 +232,14 @@ func (a *Course) Update(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if !authorizeCourse(a.Env, response, r, course.ID, false) {
+		return
+	}
+
 	err = course.Update()
 	if err != nil {
 		response.Err = err.Error()
-		response.Code = 400
+		response.Code = referenceErrorCode(err)
 		response.Json()
 		return
 	}
@@ -193,31 +271,31 @@ func (a *Course) CreateCover(w http.ResponseWriter, r *http.Request) {
 		response.Json()
 		return
 	}
+	if !authorizeCourse(a.Env, response, r, ID, false) {
+		return
+	}
 
+	limitUpload(w, r, a.ImageTypes)
 	file, header, err := r.FormFile("file")
 
 	if err != nil {
 		response.Err = err.Error()
-		response.Code = 400
+		response.Code = fileErrorCode(err)
 		response.Json()
 		return
 	}
-	validFileTypes := map[string]string{
-		"png":  "image/png",
-		"jpeg": "image/jpeg",
-		"jpg":  "image/jpeg",
-	}
 	fileLib := model.File{
 		File:       file,
 		Header:     header,
 		Prefix:     "course_cover_",
-		ValidTypes: validFileTypes,
-		Path:       a.Env.BaseDir + a.Env.ImageDir,
+		ValidTypes: a.ImageTypes,
+		Dir:        a.Env.ImageDir,
+		Env:        a.Env,
 	}
 	err = fileLib.Validate()
 	if err != nil {
 		response.Err = err.Error()
-		response.Code = 400
+		response.Code = fileErrorCode(err)
 		response.Json()
 		return
 	}
@@ -242,7 +320,7 @@ func (a *Course) CreateCover(w http.ResponseWriter, r *http.Request) {
 	}
 
 	response.Code = 200
-	response.Data = a.Env.AppURL + a.Env.ImageDir + image
+	response.Data = signedURL(a.Env, a.Media, a.Env.ImageDir, image, nil)
 	response.Json()
 
 }
@@ -269,31 +347,31 @@ func (a *Course) UpdateCover(w http.ResponseWriter, r *http.Request) {
 		response.Json()
 		return
 	}
+	if !authorizeCourse(a.Env, response, r, ID, false) {
+		return
+	}
 
+	limitUpload(w, r, a.ImageTypes)
 	file, header, err := r.FormFile("file")
 
 	if err != nil {
 		response.Err = err.Error()
-		response.Code = 400
+		response.Code = fileErrorCode(err)
 		response.Json()
 		return
 	}
-	validFileTypes := map[string]string{
-		"png":  "image/png",
-		"jpeg": "image/jpeg",
-		"jpg":  "image/jpeg",
-	}
 	fileLib := model.File{
 		File:       file,
 		Header:     header,
 		Prefix:     "course_cover_",
-		ValidTypes: validFileTypes,
-		Path:       a.Env.BaseDir + a.Env.ImageDir,
+		ValidTypes: a.ImageTypes,
+		Dir:        a.Env.ImageDir,
+		Env:        a.Env,
 	}
 	err = fileLib.Validate()
 	if err != nil {
 		response.Err = err.Error()
-		response.Code = 400
+		response.Code = fileErrorCode(err)
 		response.Json()
 		return
 	}
@@ -305,11 +383,9 @@ func (a *Course) UpdateCover(w http.ResponseWriter, r *http.Request) {
 		response.Json()
 		return
 	}
-	path := (a.Env.BaseDir + a.Env.ImageDir + *(course.Cover))
-	if _, err := os.Stat(path); err == nil {
-		err = os.Remove(path)
+	if course.Cover != nil {
+		err = fileLib.Remove(*course.Cover)
 	}
-	err = os.Remove(path)
 
 	if err != nil {
 		response.Err = err.Error()
@@ -330,7 +406,109 @@ func (a *Course) UpdateCover(w http.ResponseWriter, r *http.Request) {
 	}
 
 	response.Code = 200
-	response.Data = a.Env.AppURL + a.Env.ImageDir + image
+	response.Data = signedURL(a.Env, a.Media, a.Env.ImageDir, image, nil)
+	response.Json()
+
+}
+
+func (a *Course) Progress(w http.ResponseWriter, r *http.Request) {
+	response := &Response{W: w}
+	identity, _ := auth.FromContext(r.Context())
+	vars := mux.Vars(r)
+
+	ID, err := strconv.ParseInt(vars["id"], 10, 64)
+	if err != nil {
+		response.Err = err.Error()
+		response.Code = 400
+		response.Json()
+		return
+	}
+
+	progress := &model.VideoProgress{Env: a.Env}
+	courseProgress, err := progress.ForCourse(identity.ID, ID)
+	if err != nil {
+		response.Err = err.Error()
+		response.Code = 400
+		response.Json()
+		return
+	}
+
+	response.Code = 200
+	response.Data = courseProgress
 	response.Json()
+}
 
+func (a *Course) ChangeStatus(w http.ResponseWriter, r *http.Request) {
+	response := &Response{W: w}
+	vars := mux.Vars(r)
+
+	ID, err := strconv.ParseInt(vars["id"], 10, 64)
+	if err != nil {
+		response.Err = err.Error()
+		response.Code = 400
+		response.Json()
+		return
+	}
+
+	transition := &model.Transition{}
+	if err := json.NewDecoder(r.Body).Decode(transition); err != nil {
+		response.Err = err.Error()
+		response.Code = 400
+		response.Json()
+		return
+	}
+	if !authorizeTransition(response, r, transition) || !authorizeCourse(a.Env, response, r, ID, false) {
+		return
+	}
+
+	course := &model.Course{Env: a.Env, ID: ID}
+	if err := course.ChangeStatus(transition); err != nil {
+		response.Err = err.Error()
+		response.Code = transitionErrorCode(err)
+		response.Json()
+		return
+	}
+
+	course, err = course.GetByID(ID)
+	if err != nil {
+		response.Err = err.Error()
+		response.Code = 400
+		response.Json()
+		return
+	}
+
+	response.Code = 200
+	response.Data = course
+	response.Json()
+}
+
+func (a *Course) Restore(w http.ResponseWriter, r *http.Request) {
+	response := &Response{W: w}
+	vars := mux.Vars(r)
+
+	ID, err := strconv.ParseInt(vars["id"], 10, 64)
+	if err != nil {
+		response.Err = err.Error()
+		response.Code = 400
+		response.Json()
+		return
+	}
+
+	course := &model.Course{Env: a.Env, ID: ID}
+	err = course.Restore()
+	if err == sql.ErrNoRows {
+		response.Err = "there is no such course in the trash"
+		response.Code = 404
+		response.Json()
+		return
+	} else if err != nil {
+		response.Err = err.Error()
+		response.Code = 400
+		response.Json()
+		return
+	}
+
+	response.Code = 200
+	response.Data = ID
+	response.Json()
 }
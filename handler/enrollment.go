@@ -0,0 +1,248 @@
+package handler
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/arizanovj/courses/auth"
+	"github.com/arizanovj/courses/env"
+	"github.com/arizanovj/courses/libs"
+	"github.com/arizanovj/courses/libs/filter"
+	"github.com/arizanovj/courses/model"
+	"github.com/gorilla/mux"
+	"github.com/gorilla/schema"
+)
+
+type Enrollment struct {
+	Env   *env.Env
+	Media *auth.MediaSigner
+}
+
+type enrollRequest struct {
+	UserID    int64   `json:"user_id"`
+	ExpiresAt *string `json:"expires_at"`
+}
+
+// Enroll enrolls the caller in the course. Admins may enroll someone else
+// by passing user_id and may set an expiry.
+func (a *Enrollment) Enroll(w http.ResponseWriter, r *http.Request) {
+	response := &Response{W: w}
+	identity, _ := auth.FromContext(r.Context())
+	vars := mux.Vars(r)
+
+	courseID, err := strconv.ParseInt(vars["id"], 10, 64)
+	if err != nil {
+		response.Err = err.Error()
+		response.Code = 400
+		response.Json()
+		return
+	}
+
+	req := enrollRequest{}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && err != io.EOF {
+		response.Err = err.Error()
+		response.Code = 400
+		response.Json()
+		return
+	}
+	if (req.UserID != 0 && req.UserID != identity.ID) || req.ExpiresAt != nil {
+		if !identity.IsAdmin {
+			response.Err = "only administrators can enroll other users or set an expiry"
+			response.Code = 403
+			response.Json()
+			return
+		}
+	}
+	req.ExpiresAt, err = model.ParseExpiry(req.ExpiresAt)
+	if err != nil {
+		response.Err = err
+		response.Code = 400
+		response.Json()
+		return
+	}
+	if req.UserID == 0 {
+		req.UserID = identity.ID
+	}
+
+	course := &model.Course{Env: a.Env}
+	course, err = course.GetByID(courseID)
+	if err != nil {
+		response.Err = err.Error()
+		response.Code = 404
+		response.Json()
+		return
+	}
+	if !identity.IsAdmin && !course.IsVisible() {
+		response.Err = "there is no such course"
+		response.Code = 404
+		response.Json()
+		return
+	}
+
+	// admins may enroll past missing prerequisites, they only get a warning
+	err = course.CheckPrerequisites(req.UserID)
+	missing, isMissing := err.(*model.MissingPrerequisitesError)
+	if err != nil && !isMissing {
+		response.Err = err.Error()
+		response.Code = 400
+		response.Json()
+		return
+	}
+	if isMissing {
+		signCovers(a.Env, a.Media, missing.Courses)
+	}
+	if isMissing && !identity.IsAdmin {
+		response.Err = missing.Error()
+		response.Data = missing.Courses
+		response.Code = 409
+		response.Json()
+		return
+	}
+
+	// only admins change the expiry of an enrollment the user already has
+	enrollment := &model.Enrollment{Env: a.Env, UserID: req.UserID, CourseID: courseID, ExpiresAt: req.ExpiresAt}
+	if identity.IsAdmin {
+		enrollment.UpdateExpiry = model.ReplaceExpiry
+	}
+	if err := enrollment.Enroll(); err == model.ErrEnrollmentExpired {
+		response.Err = err.Error()
+		response.Code = 403
+		response.Json()
+		return
+	} else if err != nil {
+		response.Err = err.Error()
+		response.Code = 400
+		response.Json()
+		return
+	}
+
+	if isMissing {
+		response.Message = missing.Error()
+		response.Meta = map[string]interface{}{"missing_prerequisites": missing.Courses}
+	}
+	response.Code = 200
+	response.Data = courseID
+	response.Json()
+}
+
+func (a *Enrollment) Unenroll(w http.ResponseWriter, r *http.Request) {
+	response := &Response{W: w}
+	identity, _ := auth.FromContext(r.Context())
+	vars := mux.Vars(r)
+
+	courseID, err := strconv.ParseInt(vars["id"], 10, 64)
+	if err != nil {
+		response.Err = err.Error()
+		response.Code = 400
+		response.Json()
+		return
+	}
+
+	enrollment := &model.Enrollment{Env: a.Env, UserID: identity.ID, CourseID: courseID}
+	err = enrollment.Unenroll()
+	if err == model.ErrNotEnrolled {
+		response.Err = err.Error()
+		response.Code = 404
+		response.Json()
+		return
+	}
+	if err != nil {
+		response.Err = err.Error()
+		response.Code = 400
+		response.Json()
+		return
+	}
+
+	response.Code = 200
+	response.Data = courseID
+	response.Json()
+}
+
+// Mine lists the courses the caller is enrolled in.
+func (a *Enrollment) Mine(w http.ResponseWriter, r *http.Request) {
+	response := &Response{W: w}
+	identity, _ := auth.FromContext(r.Context())
+
+	paginator, filter, ok := a.listParams(response, r)
+	if !ok {
+		return
+	}
+
+	enrollment := &model.Enrollment{Env: a.Env}
+	enrollments, err := enrollment.GetForUser(identity.ID, paginator, filter)
+	if err != nil {
+		response.Err = err
+		response.Code = 400
+		response.Json()
+		return
+	}
+
+	for _, e := range enrollments {
+		signCovers(a.Env, a.Media, []*model.Course{e.Course})
+	}
+
+	response.Code = 200
+	response.Data = enrollments
+	response.Json()
+}
+
+// Roster lists the users enrolled in a course.
+func (a *Enrollment) Roster(w http.ResponseWriter, r *http.Request) {
+	response := &Response{W: w}
+	vars := mux.Vars(r)
+
+	courseID, err := strconv.ParseInt(vars["id"], 10, 64)
+	if err != nil {
+		response.Err = err.Error()
+		response.Code = 400
+		response.Json()
+		return
+	}
+
+	paginator, filter, ok := a.listParams(response, r)
+	if !ok {
+		return
+	}
+
+	enrollment := &model.Enrollment{Env: a.Env}
+	enrollments, err := enrollment.GetForCourse(courseID, paginator, filter)
+	if err != nil {
+		response.Err = err
+		response.Code = 400
+		response.Json()
+		return
+	}
+
+	response.Code = 200
+	response.Data = enrollments
+	response.Json()
+}
+
+func (a *Enrollment) listParams(response *Response, r *http.Request) (*pagination.Paginator, *filter.Filter, bool) {
+	paginator := &pagination.Paginator{}
+	decoder := schema.NewDecoder()
+	decoder.IgnoreUnknownKeys(true)
+	if err := decoder.Decode(paginator, r.URL.Query()); err != nil {
+		response.Err = err.Error()
+		response.Code = 400
+		response.Json()
+		return nil, nil, false
+	}
+
+	if err := paginator.Validate(); err != nil {
+		response.Err = err
+		response.Code = 400
+		response.Json()
+		return nil, nil, false
+	}
+	paginator.Env = a.Env
+
+	filter := &filter.Filter{
+		Env:   a.Env,
+		Model: model.Enrollment{},
+	}
+	filter.SetFilterParams(r.URL.Query())
+	return paginator, filter, true
+}
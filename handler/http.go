@@ -11,6 +11,7 @@ type Errors map[string]error
 
 type Response struct {
 	Data    interface{}         `json:"data"`
+	Meta    interface{}         `json:"meta,omitempty"`
 	Message string              `json:"message"`
 	Err     interface{}         `json:"error"`
 	Code    int                 `json:"code"`
@@ -0,0 +1,236 @@
+package handler
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/arizanovj/courses/auth"
+	"github.com/arizanovj/courses/env"
+	"github.com/arizanovj/courses/model"
+	"github.com/gorilla/mux"
+)
+
+type Instructor struct {
+	Env   *env.Env
+	Media *auth.MediaSigner
+}
+
+type instructorRequest struct {
+	Role string `json:"role"`
+}
+
+// authorizeCourse lets admins and instructors of the course through. With
+// ownerOnly co-instructors are refused as well. It answers the request
+// itself when access is denied.
+func authorizeCourse(e *env.Env, response *Response, r *http.Request, courseID int64, ownerOnly bool) bool {
+	identity, _ := auth.FromContext(r.Context())
+	if identity.IsAdmin {
+		return true
+	}
+
+	instructor := &model.Instructor{Env: e}
+	role, err := instructor.RoleOf(courseID, identity.ID)
+	if err != nil {
+		response.Err = err.Error()
+		response.Code = 400
+		response.Json()
+		return false
+	}
+	if role == "" || (ownerOnly && role != model.InstructorOwner) {
+		response.Err = "only instructors of this course can change it"
+		response.Code = 403
+		response.Json()
+		return false
+	}
+	return true
+}
+
+// authorizeTransition keeps publishing with the admins, instructors can only
+// send their work to review or back to draft.
+func authorizeTransition(response *Response, r *http.Request, t *model.Transition) bool {
+	if isAdmin(r) || t.Status == model.StatusDraft || t.Status == model.StatusInReview {
+		return true
+	}
+	response.Err = "only admins can publish or archive"
+	response.Code = 403
+	response.Json()
+	return false
+}
+
+// authorizeInstructor lets admins and users flagged as instructors through.
+func authorizeInstructor(e *env.Env, response *Response, r *http.Request) bool {
+	identity, _ := auth.FromContext(r.Context())
+	if identity.IsAdmin {
+		return true
+	}
+	user := &model.User{Env: e}
+	user, err := user.GetByID(identity.ID)
+	if err == nil && user.IsInstructor != nil && *user.IsInstructor {
+		return true
+	}
+	response.Err = "only instructors can create courses"
+	response.Code = 403
+	response.Json()
+	return false
+}
+
+func instructorErrorCode(err error) int {
+	switch err {
+	case model.ErrInstructorNotFound, model.ErrNotInstructor, sql.ErrNoRows:
+		return 404
+	case model.ErrLastOwner:
+		return 409
+	}
+	return 400
+}
+
+func (a *Instructor) All(w http.ResponseWriter, r *http.Request) {
+	response := &Response{W: w}
+	vars := mux.Vars(r)
+
+	courseID, err := strconv.ParseInt(vars["id"], 10, 64)
+	if err != nil {
+		response.Err = err.Error()
+		response.Code = 400
+		response.Json()
+		return
+	}
+
+	instructor := &model.Instructor{Env: a.Env}
+	instructors, err := instructor.GetForCourse(courseID)
+	if err != nil {
+		response.Err = err.Error()
+		response.Code = 400
+		response.Json()
+		return
+	}
+
+	response.Code = 200
+	response.Data = instructors
+	response.Json()
+}
+
+// Save adds an instructor to the course or changes their role, only owners
+// manage the instructors of a course.
+func (a *Instructor) Save(w http.ResponseWriter, r *http.Request) {
+	response := &Response{W: w}
+	vars := mux.Vars(r)
+
+	courseID, err := strconv.ParseInt(vars["id"], 10, 64)
+	if err != nil {
+		response.Err = err.Error()
+		response.Code = 400
+		response.Json()
+		return
+	}
+	userID, err := strconv.ParseInt(vars["user_id"], 10, 64)
+	if err != nil {
+		response.Err = err.Error()
+		response.Code = 400
+		response.Json()
+		return
+	}
+
+	req := instructorRequest{}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		response.Err = err.Error()
+		response.Code = 400
+		response.Json()
+		return
+	}
+
+	course := &model.Course{Env: a.Env}
+	if _, err := course.GetByID(courseID); err != nil {
+		response.Err = model.ErrCourseNotFound.Error()
+		response.Code = 404
+		response.Json()
+		return
+	}
+	if !authorizeCourse(a.Env, response, r, courseID, true) {
+		return
+	}
+
+	instructor := &model.Instructor{Env: a.Env, CourseID: courseID, UserID: userID, Role: req.Role}
+	if err := instructor.Validate(); err != nil {
+		response.Err = err
+		response.Code = 400
+		response.Json()
+		return
+	}
+	if err := instructor.Save(); err != nil {
+		response.Err = err.Error()
+		response.Code = instructorErrorCode(err)
+		response.Json()
+		return
+	}
+
+	response.Code = 200
+	response.Data = userID
+	response.Json()
+}
+
+func (a *Instructor) Remove(w http.ResponseWriter, r *http.Request) {
+	response := &Response{W: w}
+	vars := mux.Vars(r)
+
+	courseID, err := strconv.ParseInt(vars["id"], 10, 64)
+	if err != nil {
+		response.Err = err.Error()
+		response.Code = 400
+		response.Json()
+		return
+	}
+	userID, err := strconv.ParseInt(vars["user_id"], 10, 64)
+	if err != nil {
+		response.Err = err.Error()
+		response.Code = 400
+		response.Json()
+		return
+	}
+
+	if !authorizeCourse(a.Env, response, r, courseID, true) {
+		return
+	}
+
+	instructor := &model.Instructor{Env: a.Env, CourseID: courseID, UserID: userID}
+	if err := instructor.Remove(); err != nil {
+		response.Err = err.Error()
+		response.Code = instructorErrorCode(err)
+		response.Json()
+		return
+	}
+
+	response.Code = 200
+	response.Data = userID
+	response.Json()
+}
+
+func (a *Instructor) Profile(w http.ResponseWriter, r *http.Request) {
+	response := &Response{W: w}
+	vars := mux.Vars(r)
+
+	ID, err := strconv.ParseInt(vars["id"], 10, 64)
+	if err != nil {
+		response.Err = err.Error()
+		response.Code = 400
+		response.Json()
+		return
+	}
+
+	instructor := &model.Instructor{Env: a.Env}
+	profile, err := instructor.Profile(ID)
+	if err != nil {
+		response.Err = err.Error()
+		response.Code = instructorErrorCode(err)
+		response.Json()
+		return
+	}
+
+	signCovers(a.Env, a.Media, profile.Courses)
+
+	response.Code = 200
+	response.Data = profile
+	response.Json()
+}
@@ -0,0 +1,172 @@
+package handler
+
+import (
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/arizanovj/courses/auth"
+	"github.com/arizanovj/courses/env"
+	"github.com/arizanovj/courses/model"
+	"github.com/arizanovj/courses/storage"
+)
+
+// mediaRoot is the url prefix media files are served under, the rest of
+// the path is their key in env.Env.Storage.
+const mediaRoot = "/static/"
+
+type Media struct {
+	Env    *env.Env
+	Signer *auth.MediaSigner
+}
+
+// Serve sends a media file to whoever holds a valid signed link to it, see
+// auth.MediaSigner. <video> and <img> send no token, so a link bound to a
+// user is checked against the cookie handed out with it instead, which they
+// send unless told crossorigin="anonymous".
+func (a *Media) Serve(w http.ResponseWriter, r *http.Request) {
+	response := &Response{W: w}
+
+	claims, err := a.Signer.Verify(r.URL.Path, r.URL.Query())
+	if err != nil {
+		response.Err = err.Error()
+		response.Code = 403
+		response.Json()
+		return
+	}
+
+	if claims.UserID != nil {
+		var userID int64
+		cookie, err := r.Cookie(auth.MediaCookie)
+		if err == nil {
+			userID, err = a.Signer.VerifyUser(cookie.Value)
+		}
+		if err != nil || userID != *claims.UserID {
+			response.Err = auth.ErrLinkBound.Error()
+			response.Code = 403
+			response.Json()
+			return
+		}
+	}
+
+	name := path.Clean(r.URL.Path)
+	if !strings.HasPrefix(name, mediaRoot) {
+		response.Err = "there is no such file"
+		response.Code = 404
+		response.Json()
+		return
+	}
+	key := strings.TrimPrefix(name, "/")
+	ttl := time.Until(claims.ExpiresAt)
+
+	// backends serving files themselves get the download, the link to them
+	// expires along with the one that was followed
+	direct, err := a.Env.Storage.URL(key, ttl)
+	if err != nil {
+		response.Err = err.Error()
+		response.Code = 500
+		response.Json()
+		return
+	}
+	if direct != "" {
+		w.Header().Set("Cache-Control", "no-store")
+		http.Redirect(w, r, direct, http.StatusFound)
+		return
+	}
+
+	file, object, err := a.Env.Storage.Get(key)
+	if err == storage.ErrNotFound {
+		response.Err = "there is no such file"
+		response.Code = 404
+		response.Json()
+		return
+	} else if err != nil {
+		response.Err = err.Error()
+		response.Code = 500
+		response.Json()
+		return
+	}
+	defer file.Close()
+
+	// caches may keep the file as long as the link is valid
+	maxAge := strconv.Itoa(int(ttl.Seconds()))
+	if claims.UserID != nil {
+		w.Header().Set("Cache-Control", "private, max-age="+maxAge)
+	} else {
+		w.Header().Set("Cache-Control", "public, max-age="+maxAge)
+	}
+	w.Header().Set("ETag", object.ETag)
+	http.ServeContent(w, r, path.Base(key), object.ModTime, file)
+}
+
+// signedURL links to a file in dir, which is one of the media directories
+// of env.Env.
+func signedURL(e *env.Env, signer *auth.MediaSigner, dir string, name string, userID *int64) string {
+	return e.AppURL + signer.Sign(dir+name, userID)
+}
+
+// setMediaCookie hands out the cookie links bound to userID are checked
+// against, once per response. Browsers keep it from responses to their own
+// origin, so bound links suit apps served along with the API.
+func setMediaCookie(w http.ResponseWriter, e *env.Env, signer *auth.MediaSigner, userID int64) {
+	for _, cookie := range w.Header()["Set-Cookie"] {
+		if strings.HasPrefix(cookie, auth.MediaCookie+"=") {
+			return
+		}
+	}
+	// players on another site only send it when it is SameSite=None, which
+	// browsers accept for secure cookies alone
+	secure := strings.HasPrefix(e.AppURL, "https://")
+	sameSite := http.SameSiteLaxMode
+	if secure {
+		sameSite = http.SameSiteNoneMode
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     auth.MediaCookie,
+		Value:    signer.UserCookie(userID),
+		Path:     mediaRoot,
+		MaxAge:   int(signer.TTL.Seconds()),
+		HttpOnly: true,
+		Secure:   secure,
+		SameSite: sameSite,
+	})
+}
+
+// signCovers replaces the cover file names of courses with signed links.
+func signCovers(e *env.Env, signer *auth.MediaSigner, courses []*model.Course) {
+	for _, course := range courses {
+		if course != nil && course.Cover != nil {
+			cover := signedURL(e, signer, e.ImageDir, *course.Cover, nil)
+			course.Cover = &cover
+		}
+	}
+}
+
+// signVideos replaces the file names of videos with signed links, the file
+// itself only for those the caller may watch.
+func signVideos(e *env.Env, signer *auth.MediaSigner, w http.ResponseWriter, r *http.Request, videos []*model.Video) {
+	watch := &Video{Env: e, Media: signer}
+	for _, video := range videos {
+		if video.Cover != nil {
+			cover := signedURL(e, signer, e.ImageDir, *video.Cover, nil)
+			video.Cover = &cover
+		}
+		if code, _ := watch.watchError(r, video); code != 0 {
+			video.Src = nil
+		}
+		if video.Src != nil {
+			src := watch.srcURL(w, r, video)
+			video.Src = &src
+		}
+	}
+}
+
+// signSyllabus signs the links of every video of a syllabus.
+func signSyllabus(e *env.Env, signer *auth.MediaSigner, w http.ResponseWriter, r *http.Request, syllabus *model.Syllabus) {
+	signVideos(e, signer, w, r, syllabus.Videos)
+	for _, section := range syllabus.Sections {
+		signVideos(e, signer, w, r, section.Videos)
+	}
+}
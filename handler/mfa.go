@@ -0,0 +1,180 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+
+	"github.com/arizanovj/courses/auth"
+	"github.com/arizanovj/courses/model"
+)
+
+type mfaChallenge struct {
+	MFARequired        bool   `json:"mfa_required"`
+	MFAToken           string `json:"mfa_token"`
+	EnrollmentRequired bool   `json:"enrollment_required"`
+}
+
+type mfaCodeRequest struct {
+	Code string `json:"code"`
+}
+
+type mfaConfirmation struct {
+	RecoveryCodes []string   `json:"recovery_codes"`
+	Tokens        *tokenPair `json:"tokens,omitempty"`
+}
+
+func (a *Auth) MFAEnroll(w http.ResponseWriter, r *http.Request) {
+	response := &Response{W: w}
+	identity, _ := auth.FromContext(r.Context())
+
+	enrollment, err := a.MFA.Enroll(identity.ID, identity.Email)
+	if err == model.ErrMFAAlreadyActive {
+		response.Err = err.Error()
+		response.Code = 409
+		response.Json()
+		return
+	}
+	if err != nil {
+		response.Err = err.Error()
+		response.Code = 500
+		response.Json()
+		return
+	}
+
+	response.Code = 200
+	response.Data = enrollment
+	response.Json()
+}
+
+// MFAConfirm enables MFA once the first code checks out. When it is called
+// with the token of an admin forced to enroll during login, it also finishes
+// that login.
+func (a *Auth) MFAConfirm(w http.ResponseWriter, r *http.Request) {
+	response := &Response{W: w}
+	identity, _ := auth.FromContext(r.Context())
+
+	req := mfaCodeRequest{}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Code == "" {
+		response.Err = "code is required"
+		response.Code = 400
+		response.Json()
+		return
+	}
+
+	codes, err := a.MFA.Confirm(identity.ID, req.Code)
+	switch err {
+	case nil:
+	case model.ErrInvalidMFACode, model.ErrMFANotEnrolled:
+		response.Err = err.Error()
+		response.Code = 400
+		response.Json()
+		return
+	case model.ErrMFAAlreadyActive:
+		response.Err = err.Error()
+		response.Code = 409
+		response.Json()
+		return
+	default:
+		response.Err = err.Error()
+		response.Code = 500
+		response.Json()
+		return
+	}
+
+	confirmation := &mfaConfirmation{RecoveryCodes: codes}
+	if identity.MFA == auth.MFAStageEnroll {
+		user := &model.User{Env: a.Env}
+		user, err = user.GetByID(identity.ID)
+		if err == nil {
+			confirmation.Tokens, err = a.startSession(r, user)
+		}
+		if err != nil {
+			response.Err = err.Error()
+			response.Code = 500
+			response.Json()
+			return
+		}
+	}
+
+	response.Code = 200
+	response.Data = confirmation
+	response.Json()
+}
+
+// MFAVerify exchanges a pending MFA token and a TOTP or recovery code for a
+// full token pair. Wrong codes count against the login throttle.
+func (a *Auth) MFAVerify(w http.ResponseWriter, r *http.Request) {
+	response := &Response{W: w}
+	identity, _ := auth.FromContext(r.Context())
+
+	req := mfaCodeRequest{}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Code == "" {
+		response.Err = "code is required"
+		response.Code = 400
+		response.Json()
+		return
+	}
+
+	// the throttle fails closed, like on login
+	ip := clientIP(r)
+	wait, err := a.Throttle.Check(identity.Email, ip)
+	if err != nil {
+		fmt.Printf("%+v\n", err)
+		response.Err = "login is temporarily unavailable"
+		response.Code = 503
+		response.Json()
+		return
+	}
+	if wait > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+		response.Err = "Too many failed login attempts, try again later"
+		response.Code = 429
+		response.Json()
+		return
+	}
+
+	err = a.MFA.Verify(identity.ID, req.Code)
+	if err == model.ErrInvalidMFACode {
+		if err := a.Throttle.Fail(identity.Email, ip); err != nil {
+			fmt.Printf("%+v\n", err)
+			response.Err = "login is temporarily unavailable"
+			response.Code = 503
+			response.Json()
+			return
+		}
+		response.Err = err.Error()
+		response.Code = 400
+		response.Json()
+		return
+	}
+	if err != nil {
+		response.Err = err.Error()
+		response.Code = 400
+		response.Json()
+		return
+	}
+
+	user := &model.User{Env: a.Env}
+	user, err = user.GetByID(identity.ID)
+	if err != nil {
+		response.Err = err.Error()
+		response.Code = 401
+		response.Json()
+		return
+	}
+
+	tokens, err := a.startSession(r, user)
+	if err != nil {
+		response.Err = err.Error()
+		response.Code = 500
+		response.Json()
+		return
+	}
+
+	response.Code = 200
+	response.Data = tokens
+	response.Json()
+}
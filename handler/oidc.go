@@ -0,0 +1,167 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/arizanovj/courses/auth"
+	"github.com/arizanovj/courses/model"
+)
+
+const oidcLoginTTL = 10 * time.Minute
+
+type oidcAuthorization struct {
+	URL   string `json:"url"`
+	State string `json:"state"`
+}
+
+type oidcCallback struct {
+	Code  string `json:"code"`
+	State string `json:"state"`
+}
+
+// OIDCLogin starts a single sign-on login. The client sends the user agent
+// to the returned url and posts the code and state it gets back to
+// OIDCCallback.
+func (a *Auth) OIDCLogin(w http.ResponseWriter, r *http.Request) {
+	a.beginOIDC(&Response{W: w}, r, nil)
+}
+
+func (a *Auth) OIDCCallback(w http.ResponseWriter, r *http.Request) {
+	response := &Response{W: w}
+	login, claims, ok := a.finishOIDC(response, r)
+	if !ok {
+		return
+	}
+	if login.UserID != nil {
+		response.Err = model.ErrInvalidOIDCState.Error()
+		response.Code = 400
+		response.Json()
+		return
+	}
+
+	user := &model.User{Env: a.Env}
+	user, err := user.FindOrProvisionOIDC(claims)
+	if err == model.ErrOIDCEmailUnverified || err == model.ErrOIDCLinkRequired {
+		response.Err = err.Error()
+		response.Code = 403
+		response.Json()
+		return
+	}
+	if err != nil {
+		response.Err = err.Error()
+		response.Code = 500
+		response.Json()
+		return
+	}
+
+	a.completeLogin(response, r, user)
+}
+
+// OIDCLinkBegin starts linking a provider account to the signed in user,
+// the code and state come back to OIDCLink. Admin accounts can only use
+// single sign-on once linked this way.
+func (a *Auth) OIDCLinkBegin(w http.ResponseWriter, r *http.Request) {
+	identity, _ := auth.FromContext(r.Context())
+	a.beginOIDC(&Response{W: w}, r, &identity.ID)
+}
+
+func (a *Auth) OIDCLink(w http.ResponseWriter, r *http.Request) {
+	response := &Response{W: w}
+	identity, _ := auth.FromContext(r.Context())
+	login, claims, ok := a.finishOIDC(response, r)
+	if !ok {
+		return
+	}
+	// the state has to be one this user started linking with
+	if login.UserID == nil || *login.UserID != identity.ID {
+		response.Err = model.ErrInvalidOIDCState.Error()
+		response.Code = 400
+		response.Json()
+		return
+	}
+
+	user := &model.User{Env: a.Env, ID: identity.ID}
+	err := user.LinkOIDC(claims)
+	if err == model.ErrOIDCIdentityTaken {
+		response.Err = err.Error()
+		response.Code = 409
+		response.Json()
+		return
+	}
+	if err != nil {
+		response.Err = err.Error()
+		response.Code = 500
+		response.Json()
+		return
+	}
+
+	response.Code = 200
+	response.Message = "the identity provider account is linked"
+	response.Json()
+}
+
+// beginOIDC answers with where to send the user agent, a login started for
+// userID links the provider account to that user rather than signing in.
+func (a *Auth) beginOIDC(response *Response, r *http.Request, userID *int64) {
+	login := &model.OIDCLogin{Env: a.Env, UserID: userID}
+	login, err := login.Begin(oidcLoginTTL)
+	if err != nil {
+		response.Err = err.Error()
+		response.Code = 500
+		response.Json()
+		return
+	}
+
+	url, err := a.OIDC.AuthCodeURL(r.Context(), login.State, login.Nonce, login.Verifier)
+	if err != nil {
+		fmt.Printf("%+v\n", err)
+		response.Err = "identity provider is not available"
+		response.Code = 502
+		response.Json()
+		return
+	}
+
+	response.Code = 200
+	response.Data = &oidcAuthorization{URL: url, State: login.State}
+	response.Json()
+}
+
+// finishOIDC redeems the code and state in the request, answering the
+// request itself when that fails.
+func (a *Auth) finishOIDC(response *Response, r *http.Request) (*model.OIDCLogin, *auth.OIDCClaims, bool) {
+	req := oidcCallback{}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Code == "" || req.State == "" {
+		response.Err = "code and state are required"
+		response.Code = 400
+		response.Json()
+		return nil, nil, false
+	}
+
+	login := &model.OIDCLogin{Env: a.Env}
+	login, err := login.Finish(req.State)
+	if err == model.ErrInvalidOIDCState {
+		response.Err = err.Error()
+		response.Code = 400
+		response.Json()
+		return nil, nil, false
+	}
+	if err != nil {
+		response.Err = err.Error()
+		response.Code = 500
+		response.Json()
+		return nil, nil, false
+	}
+
+	claims, err := a.OIDC.Exchange(r.Context(), req.Code, login.Verifier, login.Nonce)
+	if err != nil {
+		fmt.Printf("%+v\n", err)
+		response.Err = "the identity provider rejected the login"
+		response.Code = 401
+		response.Json()
+		return nil, nil, false
+	}
+	return login, claims, true
+}
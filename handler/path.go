@@ -0,0 +1,301 @@
+package handler
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/arizanovj/courses/auth"
+	"github.com/arizanovj/courses/env"
+	"github.com/arizanovj/courses/model"
+	"github.com/gorilla/mux"
+)
+
+type Path struct {
+	Env   *env.Env
+	Media *auth.MediaSigner
+}
+
+func pathErrorCode(err error) int {
+	if err == model.ErrPathNotFound {
+		return 404
+	}
+	return referenceErrorCode(err)
+}
+
+func (a *Path) All(w http.ResponseWriter, r *http.Request) {
+	response := &Response{W: w}
+	path := &model.LearningPath{Env: a.Env, OnlyPublished: !isAdmin(r)}
+
+	paths, err := path.GetAll()
+	if err != nil {
+		response.Err = err.Error()
+		response.Code = 400
+		response.Json()
+		return
+	}
+
+	for _, path := range paths {
+		signCovers(a.Env, a.Media, path.Courses)
+	}
+
+	response.Code = 200
+	response.Data = paths
+	response.Json()
+}
+
+func (a *Path) Get(w http.ResponseWriter, r *http.Request) {
+	response := &Response{W: w}
+	vars := mux.Vars(r)
+
+	ID, err := strconv.ParseInt(vars["id"], 10, 64)
+	if err != nil {
+		response.Err = err.Error()
+		response.Code = 400
+		response.Json()
+		return
+	}
+
+	path := &model.LearningPath{Env: a.Env, OnlyPublished: !isAdmin(r)}
+	path, err = path.GetByID(ID)
+	if err != nil {
+		response.Err = err.Error()
+		response.Code = pathErrorCode(err)
+		response.Json()
+		return
+	}
+
+	signCovers(a.Env, a.Media, path.Courses)
+
+	response.Code = 200
+	response.Data = path
+	response.Json()
+}
+
+func (a *Path) Create(w http.ResponseWriter, r *http.Request) {
+	response := &Response{W: w}
+	path := &model.LearningPath{Env: a.Env}
+	if err := json.NewDecoder(r.Body).Decode(path); err != nil {
+		response.Err = err.Error()
+		response.Code = 400
+		response.Json()
+		return
+	}
+	path.ID = 0
+
+	if err := path.Validate(); err != nil {
+		response.Err = err
+		response.Code = 400
+		response.Json()
+		return
+	}
+
+	lastID, err := path.Create()
+	if err != nil {
+		response.Err = err.Error()
+		response.Code = pathErrorCode(err)
+		response.Json()
+		return
+	}
+
+	response.Code = 200
+	response.Data = lastID
+	response.Json()
+}
+
+func (a *Path) Update(w http.ResponseWriter, r *http.Request) {
+	response := &Response{W: w}
+	vars := mux.Vars(r)
+
+	ID, err := strconv.ParseInt(vars["id"], 10, 64)
+	if err != nil {
+		response.Err = err.Error()
+		response.Code = 400
+		response.Json()
+		return
+	}
+
+	path := &model.LearningPath{Env: a.Env}
+	if err := json.NewDecoder(r.Body).Decode(path); err != nil {
+		response.Err = err.Error()
+		response.Code = 400
+		response.Json()
+		return
+	}
+	path.ID = ID
+
+	if err := path.Validate(); err != nil {
+		response.Err = err
+		response.Code = 400
+		response.Json()
+		return
+	}
+
+	if err := path.Update(); err != nil {
+		response.Err = err.Error()
+		response.Code = pathErrorCode(err)
+		response.Json()
+		return
+	}
+
+	response.Code = 200
+	response.Data = ID
+	response.Json()
+}
+
+func (a *Path) Delete(w http.ResponseWriter, r *http.Request) {
+	response := &Response{W: w}
+	vars := mux.Vars(r)
+
+	ID, err := strconv.ParseInt(vars["id"], 10, 64)
+	if err != nil {
+		response.Err = err.Error()
+		response.Code = 400
+		response.Json()
+		return
+	}
+
+	path := &model.LearningPath{Env: a.Env, ID: ID}
+	if err := path.Delete(); err != nil {
+		response.Err = err.Error()
+		response.Code = pathErrorCode(err)
+		response.Json()
+		return
+	}
+
+	response.Code = 200
+	response.Data = ID
+	response.Json()
+}
+
+// Enroll enrolls the caller in the path and its published courses, with
+// the same rules for admins as a course enrollment.
+func (a *Path) Enroll(w http.ResponseWriter, r *http.Request) {
+	response := &Response{W: w}
+	identity, _ := auth.FromContext(r.Context())
+	vars := mux.Vars(r)
+
+	ID, err := strconv.ParseInt(vars["id"], 10, 64)
+	if err != nil {
+		response.Err = err.Error()
+		response.Code = 400
+		response.Json()
+		return
+	}
+
+	req := enrollRequest{}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && err != io.EOF {
+		response.Err = err.Error()
+		response.Code = 400
+		response.Json()
+		return
+	}
+	if (req.UserID != 0 && req.UserID != identity.ID) || req.ExpiresAt != nil {
+		if !identity.IsAdmin {
+			response.Err = "only administrators can enroll other users or set an expiry"
+			response.Code = 403
+			response.Json()
+			return
+		}
+	}
+	req.ExpiresAt, err = model.ParseExpiry(req.ExpiresAt)
+	if err != nil {
+		response.Err = err
+		response.Code = 400
+		response.Json()
+		return
+	}
+	if req.UserID == 0 {
+		req.UserID = identity.ID
+	}
+
+	path := &model.LearningPath{Env: a.Env, OnlyPublished: !identity.IsAdmin}
+	path, err = path.GetByID(ID)
+	if err != nil {
+		response.Err = err.Error()
+		response.Code = pathErrorCode(err)
+		response.Json()
+		return
+	}
+
+	err = path.CheckPrerequisites(req.UserID)
+	missing, isMissing := err.(*model.MissingPrerequisitesError)
+	if err != nil && !isMissing {
+		response.Err = err.Error()
+		response.Code = 400
+		response.Json()
+		return
+	}
+	if isMissing {
+		signCovers(a.Env, a.Media, missing.Courses)
+	}
+	if isMissing && !identity.IsAdmin {
+		response.Err = missing.Error()
+		response.Data = missing.Courses
+		response.Code = 409
+		response.Json()
+		return
+	}
+
+	// an admin's expiry applies to the path's courses the user is newly
+	// enrolled in or had lost, not to those they are already taking
+	update := model.KeepExpiry
+	if identity.IsAdmin {
+		update = model.RenewExpiry
+	}
+	if err := path.Enroll(req.UserID, req.ExpiresAt, update); err == model.ErrEnrollmentExpired {
+		response.Err = err.Error()
+		response.Code = 403
+		response.Json()
+		return
+	} else if err != nil {
+		response.Err = err.Error()
+		response.Code = 400
+		response.Json()
+		return
+	}
+
+	if isMissing {
+		response.Message = missing.Error()
+		response.Meta = map[string]interface{}{"missing_prerequisites": missing.Courses}
+	}
+	response.Code = 200
+	response.Data = path.CourseIDs
+	response.Json()
+}
+
+func (a *Path) Progress(w http.ResponseWriter, r *http.Request) {
+	response := &Response{W: w}
+	identity, _ := auth.FromContext(r.Context())
+	vars := mux.Vars(r)
+
+	ID, err := strconv.ParseInt(vars["id"], 10, 64)
+	if err != nil {
+		response.Err = err.Error()
+		response.Code = 400
+		response.Json()
+		return
+	}
+
+	path := &model.LearningPath{Env: a.Env, OnlyPublished: true}
+	path, err = path.GetByID(ID)
+	if err != nil {
+		response.Err = err.Error()
+		response.Code = pathErrorCode(err)
+		response.Json()
+		return
+	}
+
+	progress, err := path.Progress(identity.ID)
+	if err != nil {
+		response.Err = err.Error()
+		response.Code = 400
+		response.Json()
+		return
+	}
+
+	response.Code = 200
+	response.Data = progress
+	response.Json()
+}
@@ -0,0 +1,128 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/arizanovj/courses/auth"
+	"github.com/arizanovj/courses/env"
+	"github.com/arizanovj/courses/model"
+	"github.com/gorilla/mux"
+)
+
+type Prerequisite struct {
+	Env   *env.Env
+	Media *auth.MediaSigner
+}
+
+type prerequisiteRequest struct {
+	CourseIDs []int64 `json:"course_ids"`
+}
+
+// Graph returns every course the course depends on with the edges between
+// them.
+func (a *Prerequisite) Graph(w http.ResponseWriter, r *http.Request) {
+	response := &Response{W: w}
+	vars := mux.Vars(r)
+
+	ID, err := strconv.ParseInt(vars["id"], 10, 64)
+	if err != nil {
+		response.Err = err.Error()
+		response.Code = 400
+		response.Json()
+		return
+	}
+
+	unpublished, err := seesUnpublished(a.Env, r, ID)
+	if err != nil {
+		response.Err = err.Error()
+		response.Code = 400
+		response.Json()
+		return
+	}
+
+	course := &model.Course{Env: a.Env}
+	course, err = course.GetByID(ID)
+	if err != nil || (!unpublished && !course.IsVisible()) {
+		response.Err = "there is no such course"
+		response.Code = 404
+		response.Json()
+		return
+	}
+
+	graph, err := course.PrerequisiteGraph()
+	if err != nil {
+		response.Err = err.Error()
+		response.Code = 400
+		response.Json()
+		return
+	}
+
+	signCovers(a.Env, a.Media, graph.Courses)
+
+	response.Code = 200
+	response.Data = graph
+	response.Json()
+}
+
+// Set replaces the direct prerequisites of the course.
+func (a *Prerequisite) Set(w http.ResponseWriter, r *http.Request) {
+	response := &Response{W: w}
+	vars := mux.Vars(r)
+
+	ID, err := strconv.ParseInt(vars["id"], 10, 64)
+	if err != nil {
+		response.Err = err.Error()
+		response.Code = 400
+		response.Json()
+		return
+	}
+
+	req := prerequisiteRequest{}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		response.Err = err.Error()
+		response.Code = 400
+		response.Json()
+		return
+	}
+
+	course := &model.Course{Env: a.Env}
+	course, err = course.GetByID(ID)
+	if err != nil {
+		response.Err = err.Error()
+		response.Code = 404
+		response.Json()
+		return
+	}
+	if !authorizeCourse(a.Env, response, r, ID, false) {
+		return
+	}
+
+	err = course.SetPrerequisites(req.CourseIDs)
+	if err == model.ErrPrerequisiteCycle {
+		response.Err = err.Error()
+		response.Code = 409
+		response.Json()
+		return
+	} else if err != nil {
+		response.Err = err.Error()
+		response.Code = referenceErrorCode(err)
+		response.Json()
+		return
+	}
+
+	prerequisites, err := course.GetPrerequisites()
+	if err != nil {
+		response.Err = err.Error()
+		response.Code = 400
+		response.Json()
+		return
+	}
+
+	signCovers(a.Env, a.Media, prerequisites)
+
+	response.Code = 200
+	response.Data = prerequisites
+	response.Json()
+}
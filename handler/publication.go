@@ -0,0 +1,41 @@
+package handler
+
+import (
+	"database/sql"
+	"net/http"
+
+	"github.com/arizanovj/courses/auth"
+	"github.com/arizanovj/courses/env"
+	"github.com/arizanovj/courses/model"
+)
+
+// isAdmin tells whether the request may see all unpublished content.
+func isAdmin(r *http.Request) bool {
+	identity, ok := auth.FromContext(r.Context())
+	return ok && identity.IsAdmin
+}
+
+// seesUnpublished tells whether the request may see a course and its videos
+// whatever their status, its instructors can like admins.
+func seesUnpublished(e *env.Env, r *http.Request, courseID int64) (bool, error) {
+	identity, ok := auth.FromContext(r.Context())
+	if !ok {
+		return false, nil
+	}
+	if identity.IsAdmin {
+		return true, nil
+	}
+	instructor := &model.Instructor{Env: e}
+	role, err := instructor.RoleOf(courseID, identity.ID)
+	return role != "", err
+}
+
+func transitionErrorCode(err error) int {
+	switch err {
+	case model.ErrInvalidTransition:
+		return 409
+	case sql.ErrNoRows:
+		return 404
+	}
+	return 400
+}
@@ -0,0 +1,272 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/arizanovj/courses/auth"
+	"github.com/arizanovj/courses/env"
+	"github.com/arizanovj/courses/model"
+	"github.com/gorilla/mux"
+)
+
+type Section struct {
+	Env   *env.Env
+	Media *auth.MediaSigner
+}
+
+func (a *Section) All(w http.ResponseWriter, r *http.Request) {
+	response := &Response{W: w}
+	vars := mux.Vars(r)
+
+	courseID, err := strconv.ParseInt(vars["id"], 10, 64)
+	if err != nil {
+		response.Err = err.Error()
+		response.Code = 400
+		response.Json()
+		return
+	}
+
+	unpublished, err := seesUnpublished(a.Env, r, courseID)
+	if err != nil {
+		response.Err = err.Error()
+		response.Code = 400
+		response.Json()
+		return
+	}
+	if !unpublished {
+		course := &model.Course{Env: a.Env}
+		course, err = course.GetByID(courseID)
+		if err != nil || !course.IsVisible() {
+			response.Err = "there is no such course"
+			response.Code = 404
+			response.Json()
+			return
+		}
+	}
+
+	section := &model.Section{Env: a.Env}
+	sections, err := section.GetForCourse(courseID)
+	if err != nil {
+		response.Err = err.Error()
+		response.Code = 400
+		response.Json()
+		return
+	}
+
+	response.Code = 200
+	response.Data = sections
+	response.Json()
+}
+
+func (a *Section) Create(w http.ResponseWriter, r *http.Request) {
+	response := &Response{W: w}
+	vars := mux.Vars(r)
+
+	courseID, err := strconv.ParseInt(vars["id"], 10, 64)
+	if err != nil {
+		response.Err = err.Error()
+		response.Code = 400
+		response.Json()
+		return
+	}
+
+	section := &model.Section{Env: a.Env}
+	if err := json.NewDecoder(r.Body).Decode(section); err != nil {
+		response.Err = err.Error()
+		response.Code = 400
+		response.Json()
+		return
+	}
+	section.CourseID = courseID
+
+	if err := section.Validate(); err != nil {
+		response.Err = err
+		response.Code = 400
+		response.Json()
+		return
+	}
+
+	course := &model.Course{Env: a.Env}
+	if _, err := course.GetByID(courseID); err != nil {
+		response.Err = err.Error()
+		response.Code = 404
+		response.Json()
+		return
+	}
+	if !authorizeCourse(a.Env, response, r, courseID, false) {
+		return
+	}
+
+	lastID, err := section.Create()
+	if err != nil {
+		response.Err = err.Error()
+		response.Code = 400
+		response.Json()
+		return
+	}
+
+	response.Code = 200
+	response.Data = lastID
+	response.Json()
+}
+
+func (a *Section) Update(w http.ResponseWriter, r *http.Request) {
+	response := &Response{W: w}
+	vars := mux.Vars(r)
+
+	ID, err := strconv.ParseInt(vars["id"], 10, 64)
+	if err != nil {
+		response.Err = err.Error()
+		response.Code = 400
+		response.Json()
+		return
+	}
+
+	section := &model.Section{Env: a.Env}
+	if err := json.NewDecoder(r.Body).Decode(section); err != nil {
+		response.Err = err.Error()
+		response.Code = 400
+		response.Json()
+		return
+	}
+	section.ID = ID
+
+	if err := section.Validate(); err != nil {
+		response.Err = err
+		response.Code = 400
+		response.Json()
+		return
+	}
+	if !a.authorize(response, r, ID) {
+		return
+	}
+
+	err = section.Update()
+	if err == model.ErrSectionNotFound {
+		response.Err = err.Error()
+		response.Code = 404
+		response.Json()
+		return
+	} else if err != nil {
+		response.Err = err.Error()
+		response.Code = 400
+		response.Json()
+		return
+	}
+
+	response.Code = 200
+	response.Data = ID
+	response.Json()
+}
+
+func (a *Section) Delete(w http.ResponseWriter, r *http.Request) {
+	response := &Response{W: w}
+	vars := mux.Vars(r)
+
+	ID, err := strconv.ParseInt(vars["id"], 10, 64)
+	if err != nil {
+		response.Err = err.Error()
+		response.Code = 400
+		response.Json()
+		return
+	}
+
+	if !a.authorize(response, r, ID) {
+		return
+	}
+
+	section := &model.Section{Env: a.Env, ID: ID}
+	err = section.Delete()
+	if err == model.ErrSectionNotFound {
+		response.Err = err.Error()
+		response.Code = 404
+		response.Json()
+		return
+	} else if err != nil {
+		response.Err = err.Error()
+		response.Code = 400
+		response.Json()
+		return
+	}
+
+	response.Code = 200
+	response.Data = ID
+	response.Json()
+}
+
+// Reorder takes the complete ordered syllabus of a course and applies it at
+// once, see model.SyllabusOrder.
+func (a *Section) Reorder(w http.ResponseWriter, r *http.Request) {
+	response := &Response{W: w}
+	vars := mux.Vars(r)
+
+	courseID, err := strconv.ParseInt(vars["id"], 10, 64)
+	if err != nil {
+		response.Err = err.Error()
+		response.Code = 400
+		response.Json()
+		return
+	}
+
+	order := &model.SyllabusOrder{}
+	if err := json.NewDecoder(r.Body).Decode(order); err != nil {
+		response.Err = err.Error()
+		response.Code = 400
+		response.Json()
+		return
+	}
+
+	course := &model.Course{Env: a.Env}
+	course, err = course.GetByID(courseID)
+	if err != nil {
+		response.Err = err.Error()
+		response.Code = 404
+		response.Json()
+		return
+	}
+	if !authorizeCourse(a.Env, response, r, courseID, false) {
+		return
+	}
+
+	err = course.Reorder(order)
+	if err == model.ErrSyllabusMismatch {
+		response.Err = err.Error()
+		response.Code = 422
+		response.Json()
+		return
+	} else if err != nil {
+		response.Err = err.Error()
+		response.Code = 400
+		response.Json()
+		return
+	}
+
+	syllabus, err := course.GetSyllabus()
+	if err != nil {
+		response.Err = err.Error()
+		response.Code = 400
+		response.Json()
+		return
+	}
+
+	signSyllabus(a.Env, a.Media, w, r, syllabus)
+
+	response.Code = 200
+	response.Data = syllabus
+	response.Json()
+}
+
+// authorize checks the caller teaches the course the section belongs to.
+func (a *Section) authorize(response *Response, r *http.Request, ID int64) bool {
+	section := &model.Section{Env: a.Env}
+	section, err := section.GetByID(ID)
+	if err != nil {
+		response.Err = err.Error()
+		response.Code = 404
+		response.Json()
+		return false
+	}
+	return authorizeCourse(a.Env, response, r, section.CourseID, false)
+}
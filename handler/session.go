@@ -0,0 +1,60 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/arizanovj/courses/auth"
+	"github.com/arizanovj/courses/env"
+	"github.com/arizanovj/courses/model"
+	"github.com/gorilla/mux"
+)
+
+type Session struct {
+	Env *env.Env
+}
+
+func (a *Session) All(w http.ResponseWriter, r *http.Request) {
+	response := &Response{W: w}
+	identity, _ := auth.FromContext(r.Context())
+
+	session := &model.Session{Env: a.Env}
+	sessions, err := session.GetForUser(identity.ID)
+	if err != nil {
+		response.Err = err.Error()
+		response.Code = 400
+		response.Json()
+		return
+	}
+	for _, s := range sessions {
+		s.Current = s.ID == identity.SessionID
+	}
+
+	response.Code = 200
+	response.Data = sessions
+	response.Json()
+}
+
+func (a *Session) Delete(w http.ResponseWriter, r *http.Request) {
+	response := &Response{W: w}
+	identity, _ := auth.FromContext(r.Context())
+	ID := mux.Vars(r)["id"]
+
+	session := &model.Session{Env: a.Env}
+	err := session.Revoke(identity.ID, ID)
+	if err == model.ErrSessionNotFound {
+		response.Err = err.Error()
+		response.Code = 404
+		response.Json()
+		return
+	}
+	if err != nil {
+		response.Err = err.Error()
+		response.Code = 400
+		response.Json()
+		return
+	}
+
+	response.Code = 200
+	response.Data = ID
+	response.Json()
+}
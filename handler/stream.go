@@ -0,0 +1,158 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/arizanovj/courses/auth"
+	"github.com/arizanovj/courses/model"
+	"github.com/arizanovj/courses/storage"
+	"github.com/gorilla/mux"
+)
+
+// Stream serves the file of the video to those allowed to watch it. Range,
+// If-Range and the conditional headers are answered by http.ServeContent
+// against the ETag set here.
+func (a *Video) Stream(w http.ResponseWriter, r *http.Request) {
+	response := &Response{W: w}
+	vars := mux.Vars(r)
+
+	ID, err := strconv.ParseInt(vars["id"], 10, 64)
+	if err != nil {
+		response.Err = err.Error()
+		response.Code = 400
+		response.Json()
+		return
+	}
+
+	video := &model.Video{Env: a.Env}
+	video, err = video.GetByID(ID)
+	if err != nil {
+		response.Err = "there is no such video"
+		response.Code = 404
+		response.Json()
+		return
+	}
+	if !a.authorizeWatch(response, r, video) {
+		return
+	}
+	if video.Src == nil {
+		response.Err = "the video has no file yet"
+		response.Code = 404
+		response.Json()
+		return
+	}
+
+	file, object, err := a.Env.Storage.Get(model.StorageKey(a.Env.VideoDir, filepath.Base(*video.Src)))
+	if err == storage.ErrNotFound {
+		response.Err = "the video file is missing"
+		response.Code = 404
+		response.Json()
+		return
+	} else if err != nil {
+		response.Err = err.Error()
+		response.Code = 500
+		response.Json()
+		return
+	}
+	defer file.Close()
+
+	etag := object.ETag
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Cache-Control", "private")
+
+	if isNewView(r, etag) {
+		view := &model.VideoView{Env: a.Env, VideoID: video.ID, IP: clientIP(r), UserAgent: r.UserAgent()}
+		if identity, ok := auth.FromContext(r.Context()); ok {
+			view.UserID = &identity.ID
+		}
+		if err := view.Log(); err != nil {
+			fmt.Printf("%+v\n", err)
+		}
+	}
+
+	http.ServeContent(w, r, filepath.Base(*video.Src), object.ModTime, file)
+}
+
+// authorizeWatch answers the request itself when the caller may not watch
+// the video.
+func (a *Video) authorizeWatch(response *Response, r *http.Request, video *model.Video) bool {
+	code, err := a.watchError(r, video)
+	if err != nil {
+		response.Err = err.Error()
+		response.Code = code
+		response.Json()
+		return false
+	}
+	return true
+}
+
+// watchError lets admins and instructors of the course watch anything,
+// everyone else needs the video to be available and either public or an
+// active enrollment in its course. It returns the status to refuse with.
+func (a *Video) watchError(r *http.Request, video *model.Video) (int, error) {
+	identity, loggedIn := auth.FromContext(r.Context())
+	if loggedIn && identity.IsAdmin {
+		return 0, nil
+	}
+	if loggedIn {
+		instructor := &model.Instructor{Env: a.Env}
+		role, err := instructor.RoleOf(video.CourseID, identity.ID)
+		if err != nil {
+			return 400, err
+		}
+		if role != "" {
+			return 0, nil
+		}
+	}
+
+	available, err := video.IsAvailable()
+	if err != nil {
+		return 400, err
+	}
+	if !available || video.Offline {
+		return 404, errors.New("there is no such video")
+	}
+	if video.Public {
+		return 0, nil
+	}
+	if !loggedIn {
+		return 401, errors.New("log in to watch this video")
+	}
+
+	enrollment := &model.Enrollment{Env: a.Env}
+	enrolled, err := enrollment.IsActive(identity.ID, video.CourseID)
+	if err != nil {
+		return 400, err
+	}
+	if !enrolled {
+		return 403, model.ErrNotEnrolled
+	}
+	return 0, nil
+}
+
+// isNewView tells whether the request starts a playback. Players fetch the
+// rest of the file with further range requests which are not counted, nor
+// are revalidations answered with 304.
+func isNewView(r *http.Request, etag string) bool {
+	if r.Method != "GET" || r.Header.Get("If-None-Match") == etag {
+		return false
+	}
+	rangeHeader := r.Header.Get("Range")
+	return rangeHeader == "" || strings.HasPrefix(rangeHeader, "bytes=0-")
+}
+
+// srcURL is a signed link to the file of the video, bound to the caller
+// unless the video is public. The cookie bound links need is set on w.
+func (a *Video) srcURL(w http.ResponseWriter, r *http.Request, video *model.Video) string {
+	var userID *int64
+	if identity, ok := auth.FromContext(r.Context()); ok && a.Media.BindUser && !video.Public {
+		userID = &identity.ID
+		setMediaCookie(w, a.Env, a.Media, identity.ID)
+	}
+	return signedURL(a.Env, a.Media, a.Env.VideoDir, *video.Src, userID)
+}
@@ -0,0 +1,138 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/arizanovj/courses/env"
+	"github.com/arizanovj/courses/model"
+	"github.com/gorilla/mux"
+)
+
+type Tag struct {
+	Env *env.Env
+}
+
+func tagErrorCode(err error) int {
+	switch err {
+	case model.ErrTagNotFound:
+		return 404
+	case model.ErrTagTaken:
+		return 409
+	}
+	return 400
+}
+
+func (a *Tag) All(w http.ResponseWriter, r *http.Request) {
+	response := &Response{W: w}
+	tag := &model.Tag{Env: a.Env}
+
+	tags, err := tag.GetAll()
+	if err != nil {
+		response.Err = err.Error()
+		response.Code = 400
+		response.Json()
+		return
+	}
+
+	response.Code = 200
+	response.Data = tags
+	response.Json()
+}
+
+func (a *Tag) Create(w http.ResponseWriter, r *http.Request) {
+	response := &Response{W: w}
+	tag := &model.Tag{Env: a.Env}
+	if err := json.NewDecoder(r.Body).Decode(tag); err != nil {
+		response.Err = err.Error()
+		response.Code = 400
+		response.Json()
+		return
+	}
+	tag.ID = 0
+
+	if err := tag.Validate(); err != nil {
+		response.Err = err
+		response.Code = 400
+		response.Json()
+		return
+	}
+
+	lastID, err := tag.Create()
+	if err != nil {
+		response.Err = err.Error()
+		response.Code = tagErrorCode(err)
+		response.Json()
+		return
+	}
+
+	response.Code = 200
+	response.Data = lastID
+	response.Json()
+}
+
+func (a *Tag) Update(w http.ResponseWriter, r *http.Request) {
+	response := &Response{W: w}
+	vars := mux.Vars(r)
+
+	ID, err := strconv.ParseInt(vars["id"], 10, 64)
+	if err != nil {
+		response.Err = err.Error()
+		response.Code = 400
+		response.Json()
+		return
+	}
+
+	tag := &model.Tag{Env: a.Env}
+	if err := json.NewDecoder(r.Body).Decode(tag); err != nil {
+		response.Err = err.Error()
+		response.Code = 400
+		response.Json()
+		return
+	}
+	tag.ID = ID
+
+	if err := tag.Validate(); err != nil {
+		response.Err = err
+		response.Code = 400
+		response.Json()
+		return
+	}
+
+	if err := tag.Update(); err != nil {
+		response.Err = err.Error()
+		response.Code = tagErrorCode(err)
+		response.Json()
+		return
+	}
+
+	response.Code = 200
+	response.Data = ID
+	response.Json()
+}
+
+func (a *Tag) Delete(w http.ResponseWriter, r *http.Request) {
+	response := &Response{W: w}
+	vars := mux.Vars(r)
+
+	ID, err := strconv.ParseInt(vars["id"], 10, 64)
+	if err != nil {
+		response.Err = err.Error()
+		response.Code = 400
+		response.Json()
+		return
+	}
+
+	tag := &model.Tag{Env: a.Env, ID: ID}
+	if err := tag.Delete(); err != nil {
+		response.Err = err.Error()
+		response.Code = tagErrorCode(err)
+		response.Json()
+		return
+	}
+
+	response.Code = 200
+	response.Data = ID
+	response.Json()
+}
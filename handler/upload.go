@@ -0,0 +1,288 @@
+package handler
+
+import (
+	"encoding/base64"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/arizanovj/courses/auth"
+	"github.com/arizanovj/courses/env"
+	"github.com/arizanovj/courses/model"
+	"github.com/gorilla/mux"
+)
+
+const tusVersion = "1.0.0"
+
+// Upload implements the core, creation and termination parts of tus 1.0
+// (https://tus.io/protocols/resumable-upload.html) for the files of videos.
+type Upload struct {
+	Env     *env.Env
+	MaxSize int64
+	Expiry  time.Duration
+	// Types are the MIME types accepted for video files, with the largest
+	// size allowed for each. Uploads are recognized once complete.
+	Types map[string]int64
+}
+
+// Options answers both tus discovery and CORS preflight, which have to
+// allow the tus headers.
+func (a *Upload) Options(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Allow-Headers", "Authorization, Content-Type, Tus-Resumable, Upload-Length, Upload-Metadata, Upload-Offset")
+	w.Header().Set("Access-Control-Allow-Methods", "POST, HEAD, PATCH, DELETE, OPTIONS")
+	w.Header().Set("Access-Control-Expose-Headers", "Location, Tus-Resumable, Tus-Version, Tus-Extension, Tus-Max-Size, Upload-Length, Upload-Offset")
+	w.Header().Set("Tus-Resumable", tusVersion)
+	w.Header().Set("Tus-Version", tusVersion)
+	w.Header().Set("Tus-Extension", "creation,termination")
+	w.Header().Set("Tus-Max-Size", strconv.FormatInt(a.MaxSize, 10))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Create starts the upload of a new file for the video, it replaces the
+// current one once complete.
+func (a *Upload) Create(w http.ResponseWriter, r *http.Request) {
+	response := &Response{W: w}
+	identity, _ := auth.FromContext(r.Context())
+	if !a.checkVersion(response, r) {
+		return
+	}
+	vars := mux.Vars(r)
+
+	videoID, err := strconv.ParseInt(vars["id"], 10, 64)
+	if err != nil {
+		response.Err = err.Error()
+		response.Code = 400
+		response.Json()
+		return
+	}
+
+	video := &model.Video{Env: a.Env}
+	video, err = video.GetByID(videoID)
+	if err != nil {
+		response.Err = "there is no such video"
+		response.Code = 404
+		response.Json()
+		return
+	}
+	if !authorizeCourse(a.Env, response, r, video.CourseID, false) {
+		return
+	}
+
+	length, err := strconv.ParseInt(r.Header.Get("Upload-Length"), 10, 64)
+	if err != nil || length < 0 {
+		response.Err = "Upload-Length is missing or invalid"
+		response.Code = 400
+		response.Json()
+		return
+	}
+	if length > a.MaxSize {
+		response.Err = "the file is larger than " + strconv.FormatInt(a.MaxSize, 10) + " bytes"
+		response.Code = 413
+		response.Json()
+		return
+	}
+
+	// the type isn't known before the file starts arriving, only a length
+	// no type allows is refused now
+	var largest int64
+	for _, maxSize := range a.Types {
+		if maxSize > largest {
+			largest = maxSize
+		}
+	}
+	if length > largest {
+		response.Err = "video files can't be larger than " + strconv.FormatInt(largest, 10) + " bytes"
+		response.Code = 413
+		response.Json()
+		return
+	}
+
+	// the name is only kept for reference, the file is stored under the
+	// extension of the type it turns out to be
+	metadata := parseUploadMetadata(r.Header.Get("Upload-Metadata"))
+	extension := []rune(strings.ToLower(strings.TrimPrefix(filepath.Ext(metadata["filename"]), ".")))
+	if len(extension) > 8 {
+		extension = extension[:8]
+	}
+
+	upload := &model.Upload{Env: a.Env, VideoID: video.ID, UserID: identity.ID, Length: length, Extension: string(extension), Expiry: a.Expiry}
+	if err := upload.Create(); err != nil {
+		response.Err = err.Error()
+		response.Code = 500
+		response.Json()
+		return
+	}
+
+	w.Header().Set("Location", a.Env.AppURL+"/v1/uploads/"+upload.ID)
+	w.WriteHeader(http.StatusCreated)
+}
+
+// Head tells the client where to resume from.
+func (a *Upload) Head(w http.ResponseWriter, r *http.Request) {
+	response := &Response{W: w}
+	if !a.checkVersion(response, r) {
+		return
+	}
+	upload, ok := a.load(response, r)
+	if !ok {
+		return
+	}
+
+	w.Header().Set("Upload-Offset", strconv.FormatInt(upload.Offset, 10))
+	w.Header().Set("Upload-Length", strconv.FormatInt(upload.Length, 10))
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusOK)
+}
+
+// Patch appends a chunk, the last one attaches the file to the video.
+func (a *Upload) Patch(w http.ResponseWriter, r *http.Request) {
+	response := &Response{W: w}
+	if !a.checkVersion(response, r) {
+		return
+	}
+	if r.Header.Get("Content-Type") != "application/offset+octet-stream" {
+		response.Err = "Content-Type has to be application/offset+octet-stream"
+		response.Code = 415
+		response.Json()
+		return
+	}
+	offset, err := strconv.ParseInt(r.Header.Get("Upload-Offset"), 10, 64)
+	if err != nil || offset < 0 {
+		response.Err = "Upload-Offset is missing or invalid"
+		response.Code = 400
+		response.Json()
+		return
+	}
+	upload, ok := a.load(response, r)
+	if !ok {
+		return
+	}
+
+	err = upload.Append(offset, r.Body)
+	switch {
+	case err == model.ErrUploadOffset:
+		response.Err = err.Error()
+		response.Code = 409
+		response.Json()
+		return
+	case err == model.ErrUploadNotFound:
+		response.Err = err.Error()
+		response.Code = 404
+		response.Json()
+		return
+	case fileErrorCode(err) != 400:
+		response.Err = err.Error()
+		response.Code = fileErrorCode(err)
+		response.Json()
+		return
+	case err != nil:
+		response.Err = err.Error()
+		response.Code = 500
+		response.Json()
+		return
+	}
+
+	w.Header().Set("Upload-Offset", strconv.FormatInt(upload.Offset, 10))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Delete terminates the upload.
+func (a *Upload) Delete(w http.ResponseWriter, r *http.Request) {
+	response := &Response{W: w}
+	if !a.checkVersion(response, r) {
+		return
+	}
+	upload, ok := a.load(response, r)
+	if !ok {
+		return
+	}
+
+	if err := upload.Terminate(); err != nil {
+		response.Err = err.Error()
+		response.Code = 404
+		response.Json()
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// checkVersion sets the tus headers every response carries and refuses
+// clients speaking another version of the protocol.
+func (a *Upload) checkVersion(response *Response, r *http.Request) bool {
+	response.W.Header().Set("Tus-Resumable", tusVersion)
+	response.W.Header().Set("Access-Control-Expose-Headers", "Location, Tus-Resumable, Tus-Version, Upload-Length, Upload-Offset")
+	if r.Header.Get("Tus-Resumable") != tusVersion {
+		response.W.Header().Set("Tus-Version", tusVersion)
+		response.Err = "unsupported tus version"
+		response.Code = 412
+		response.Json()
+		return false
+	}
+	return true
+}
+
+// load reads the upload in the url, only its creator and admins see it. The
+// creator has to still teach the course of the video, or may go on
+// replacing its file after being removed as instructor.
+func (a *Upload) load(response *Response, r *http.Request) (*model.Upload, bool) {
+	identity, _ := auth.FromContext(r.Context())
+	vars := mux.Vars(r)
+
+	upload := &model.Upload{Env: a.Env}
+	upload, err := upload.GetByID(vars["id"])
+	if err == nil && !identity.IsAdmin && upload.UserID != identity.ID {
+		err = model.ErrUploadNotFound
+	}
+	if err == model.ErrUploadNotFound {
+		response.Err = err.Error()
+		response.Code = 404
+		response.Json()
+		return nil, false
+	} else if err != nil {
+		response.Err = err.Error()
+		response.Code = 500
+		response.Json()
+		return nil, false
+	}
+
+	video := &model.Video{Env: a.Env}
+	video, err = video.GetByID(upload.VideoID)
+	if err != nil {
+		response.Err = "there is no such video"
+		response.Code = 404
+		response.Json()
+		return nil, false
+	}
+	if !authorizeCourse(a.Env, response, r, video.CourseID, false) {
+		return nil, false
+	}
+
+	upload.Expiry = a.Expiry
+	upload.Types = a.Types
+	return upload, true
+}
+
+// parseUploadMetadata decodes the Upload-Metadata header, comma separated
+// pairs of a key and a base64 encoded value.
+func parseUploadMetadata(header string) map[string]string {
+	metadata := make(map[string]string)
+	for _, pair := range strings.Split(header, ",") {
+		parts := strings.Fields(pair)
+		if len(parts) == 0 {
+			continue
+		}
+		value := ""
+		if len(parts) > 1 {
+			decoded, err := base64.StdEncoding.DecodeString(parts[1])
+			if err != nil {
+				continue
+			}
+			value = string(decoded)
+		}
+		metadata[parts[0]] = value
+	}
+	return metadata
+}
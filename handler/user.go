@@ -1,6 +1,7 @@
 package handler
 
 import (
+	"database/sql"
 	"encoding/json"
 	"net/http"
 	"strconv"
@@ -18,8 +19,16 @@ type User struct {
 }
 
 func (a *User) All(w http.ResponseWriter, r *http.Request) {
+	a.list(w, r, &model.User{Env: a.Env})
+}
+
+// Trash lists what was deleted and not purged yet.
+func (a *User) Trash(w http.ResponseWriter, r *http.Request) {
+	a.list(w, r, &model.User{Env: a.Env, Trash: true})
+}
+
+func (a *User) list(w http.ResponseWriter, r *http.Request, user *model.User) {
 	response := &Response{W: w}
-	user := &model.User{Env: a.Env}
 	paginator := &pagination.Paginator{}
 	decoder := schema.NewDecoder()
 	decoder.IgnoreUnknownKeys(true)
@@ -166,3 +175,95 @@ func (a *User) Delete(w http.ResponseWriter, r *http.Request) {
 	response.Json()
 
 }
+
+func (a *User) Unlock(w http.ResponseWriter, r *http.Request) {
+	response := &Response{W: w}
+	vars := mux.Vars(r)
+
+	ID, err := strconv.ParseInt(vars["id"], 10, 64)
+
+	if err != nil {
+		response.Err = err.Error()
+		response.Code = 400
+		response.Json()
+		return
+	}
+
+	user := &model.User{Env: a.Env}
+	user, err = user.GetByID(ID)
+	if err != nil {
+		response.Err = err.Error()
+		response.Code = 404
+		response.Json()
+		return
+	}
+
+	throttle := &model.LoginThrottle{Env: a.Env}
+	if err := throttle.Unlock(user.Email); err != nil {
+		response.Err = err.Error()
+		response.Code = 400
+		response.Json()
+		return
+	}
+
+	response.Code = 200
+	response.Data = ID
+	response.Json()
+}
+
+func (a *User) RevokeSessions(w http.ResponseWriter, r *http.Request) {
+	response := &Response{W: w}
+	vars := mux.Vars(r)
+
+	ID, err := strconv.ParseInt(vars["id"], 10, 64)
+
+	if err != nil {
+		response.Err = err.Error()
+		response.Code = 400
+		response.Json()
+		return
+	}
+
+	session := &model.Session{Env: a.Env}
+	if err := session.RevokeAllForUser(ID); err != nil {
+		response.Err = err.Error()
+		response.Code = 400
+		response.Json()
+		return
+	}
+
+	response.Code = 200
+	response.Data = ID
+	response.Json()
+}
+
+func (a *User) Restore(w http.ResponseWriter, r *http.Request) {
+	response := &Response{W: w}
+	vars := mux.Vars(r)
+
+	ID, err := strconv.ParseInt(vars["id"], 10, 64)
+	if err != nil {
+		response.Err = err.Error()
+		response.Code = 400
+		response.Json()
+		return
+	}
+
+	user := &model.User{Env: a.Env, ID: ID}
+	err = user.Restore()
+	if err == sql.ErrNoRows {
+		response.Err = "there is no such user in the trash"
+		response.Code = 404
+		response.Json()
+		return
+	} else if err != nil {
+		response.Err = err.Error()
+		response.Code = 400
+		response.Json()
+		return
+	}
+
+	response.Code = 200
+	response.Data = ID
+	response.Json()
+}
@@ -1,11 +1,13 @@
 package handler
 
 import (
+	"database/sql"
 	"encoding/json"
+	"errors"
 	"net/http"
-	"os"
 	"strconv"
 
+	"github.com/arizanovj/courses/auth"
 	"github.com/arizanovj/courses/env"
 	"github.com/arizanovj/courses/libs"
 	"github.com/arizanovj/courses/libs/filter"
@@ -14,24 +16,79 @@ import (
 	"github.com/gorilla/schema"
 )
 
-var validImageFileTypes = map[string]string{
-	"png":  "image/png",
-	"jpeg": "image/jpeg",
-	"jpg":  "image/jpeg",
+type Video struct {
+	Env                 *env.Env
+	CompletionThreshold float64
+	Media               *auth.MediaSigner
+	// ImageTypes and VideoTypes are the MIME types accepted for covers and
+	// files, with the largest size allowed for each.
+	ImageTypes map[string]int64
+	VideoTypes map[string]int64
 }
 
-var validVideoFileTypes = map[string]string{
-	"webm": "video/webm",
-	"mp4":  "ivideo/mp4",
+// referenceErrorCode tells apart references to a missing course, section or
+// category from other failures of a write.
+func referenceErrorCode(err error) int {
+	switch err {
+	case model.ErrCourseNotFound, model.ErrSectionNotFound, model.ErrSectionNotInCourse, model.ErrVideoCourseChange, model.ErrCategoryNotFound:
+		return 422
+	}
+	return 400
 }
 
-type Video struct {
-	Env *env.Env
+// multipartOverhead is allowed on top of the largest file for the other
+// parts and boundaries of an upload's body.
+const multipartOverhead = 1 << 20
+
+// limitUpload caps the request body at the largest size allowed in types, so
+// a too large upload is refused before it is spooled to disk.
+func limitUpload(w http.ResponseWriter, r *http.Request, types map[string]int64) {
+	var largest int64
+	for _, size := range types {
+		if size > largest {
+			largest = size
+		}
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, largest+multipartOverhead)
+}
+
+// fileErrorCode answers an upload of the wrong type with 415 and a too large
+// one with 413.
+func fileErrorCode(err error) int {
+	if err == model.ErrFileType {
+		return 415
+	}
+	if _, ok := err.(*model.FileTooLargeError); ok {
+		return 413
+	}
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		return 413
+	}
+	return 400
+}
+
+type progressReport struct {
+	Position int64 `json:"position"`
+	Watched  int64 `json:"watched"`
+	Duration int64 `json:"duration"`
 }
 
 func (a *Video) All(w http.ResponseWriter, r *http.Request) {
+	video := &model.Video{Env: a.Env, OnlyPublished: !isAdmin(r)}
+	if identity, ok := auth.FromContext(r.Context()); ok {
+		video.InstructorID = identity.ID
+	}
+	a.list(w, r, video)
+}
+
+// Trash lists what was deleted and not purged yet.
+func (a *Video) Trash(w http.ResponseWriter, r *http.Request) {
+	a.list(w, r, &model.Video{Env: a.Env, Trash: true})
+}
+
+func (a *Video) list(w http.ResponseWriter, r *http.Request, video *model.Video) {
 	response := &Response{W: w}
-	video := &model.Video{Env: a.Env}
 	paginator := &pagination.Paginator{}
 	decoder := schema.NewDecoder()
 	decoder.IgnoreUnknownKeys(true)
@@ -56,7 +113,7 @@ func (a *Video) All(w http.ResponseWriter, r *http.Request) {
 	}
 	filter.SetFilterParams(r.URL.Query())
 
-	courses, err := video.Get(paginator, filter)
+	videos, err := video.Get(paginator, filter)
 
 	if err != nil {
 		response.Err = err
@@ -64,9 +121,10 @@ func (a *Video) All(w http.ResponseWriter, r *http.Request) {
 		response.Json()
 		return
 	}
+	signVideos(a.Env, a.Media, w, r, videos)
 
 	response.Code = 200
-	response.Data = courses
+	response.Data = videos
 	response.Json()
 }
 
@@ -86,11 +144,15 @@ func (a *Video) Create(w http.ResponseWriter, r *http.Request) {
 
 	//err = video.Validate()
 
+	if !authorizeCourse(a.Env, response, r, video.CourseID, false) {
+		return
+	}
+
 	lastID, err := video.Create()
 
 	if err != nil {
 		response.Err = err.Error()
-		response.Code = 400
+		response.Code = referenceErrorCode(err)
 		response.Json()
 		return
 	}
@@ -122,14 +184,40 @@ func (a *Video) Get(w http.ResponseWriter, r *http.Request) {
 		response.Json()
 		return
 	}
-	if videoData.Cover != nil {
-		coverPath := a.Env.AppURL + a.Env.ImageDir + *(videoData.Cover)
-		video.Cover = &coverPath
+	unpublished, err := seesUnpublished(a.Env, r, videoData.CourseID)
+	if err != nil {
+		response.Err = err.Error()
+		response.Code = 400
+		response.Json()
+		return
+	}
+	if !unpublished {
+		available, err := videoData.IsAvailable()
+		if err != nil {
+			response.Err = err.Error()
+			response.Code = 400
+			response.Json()
+			return
+		}
+		if !available {
+			response.Err = "there is no such video"
+			response.Code = 404
+			response.Json()
+			return
+		}
 	}
+	// the file is only linked for those who may watch it
+	signVideos(a.Env, a.Media, w, r, []*model.Video{videoData})
 
-	if videoData.Src != nil {
-		videoPath := a.Env.AppURL + a.Env.VideoDir + *(videoData.Src)
-		video.Src = &videoPath
+	if identity, ok := auth.FromContext(r.Context()); ok {
+		progress := &model.VideoProgress{Env: a.Env}
+		videoData.Progress, err = progress.Get(identity.ID, videoData.ID)
+		if err != nil {
+			response.Err = err.Error()
+			response.Code = 400
+			response.Json()
+			return
+		}
 	}
 
 	response.Code = 200
@@ -150,6 +238,10 @@ func (a *Video) Delete(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if !a.authorize(response, r, ID) {
+		return
+	}
+
 	video := &model.Video{Env: a.Env, ID: ID}
 	err = video.Delete()
 	if err != nil {
@@ -177,10 +269,19 @@ func (a *Video) Update(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if !a.authorize(response, r, video.ID) {
+		return
+	}
+
 	err = video.Update()
-	if err != nil {
+	if err == sql.ErrNoRows {
+		response.Err = "there is no such video"
+		response.Code = 404
+		response.Json()
+		return
+	} else if err != nil {
 		response.Err = err.Error()
-		response.Code = 400
+		response.Code = referenceErrorCode(err)
 		response.Json()
 		return
 	}
@@ -212,12 +313,16 @@ func (a *Video) CreateCover(w http.ResponseWriter, r *http.Request) {
 		response.Json()
 		return
 	}
+	if !authorizeCourse(a.Env, response, r, video.CourseID, false) {
+		return
+	}
 
+	limitUpload(w, r, a.ImageTypes)
 	file, header, err := r.FormFile("file")
 
 	if err != nil {
 		response.Err = err.Error()
-		response.Code = 400
+		response.Code = fileErrorCode(err)
 		response.Json()
 		return
 	}
@@ -226,13 +331,14 @@ func (a *Video) CreateCover(w http.ResponseWriter, r *http.Request) {
 		File:       file,
 		Header:     header,
 		Prefix:     "video_cover_",
-		ValidTypes: validImageFileTypes,
-		Path:       a.Env.BaseDir + a.Env.ImageDir,
+		ValidTypes: a.ImageTypes,
+		Dir:        a.Env.ImageDir,
+		Env:        a.Env,
 	}
 	err = fileLib.Validate()
 	if err != nil {
 		response.Err = err.Error()
-		response.Code = 400
+		response.Code = fileErrorCode(err)
 		response.Json()
 		return
 	}
@@ -257,7 +363,7 @@ func (a *Video) CreateCover(w http.ResponseWriter, r *http.Request) {
 	}
 
 	response.Code = 200
-	response.Data = a.Env.AppURL + a.Env.ImageDir + image
+	response.Data = signedURL(a.Env, a.Media, a.Env.ImageDir, image, nil)
 	response.Json()
 
 }
@@ -284,12 +390,16 @@ func (a *Video) UpdateCover(w http.ResponseWriter, r *http.Request) {
 		response.Json()
 		return
 	}
+	if !authorizeCourse(a.Env, response, r, video.CourseID, false) {
+		return
+	}
 
+	limitUpload(w, r, a.ImageTypes)
 	file, header, err := r.FormFile("file")
 
 	if err != nil {
 		response.Err = err.Error()
-		response.Code = 400
+		response.Code = fileErrorCode(err)
 		response.Json()
 		return
 	}
@@ -298,14 +408,15 @@ func (a *Video) UpdateCover(w http.ResponseWriter, r *http.Request) {
 		File:       file,
 		Header:     header,
 		Prefix:     "video_cover_",
-		ValidTypes: validImageFileTypes,
-		Path:       a.Env.BaseDir + a.Env.ImageDir,
+		ValidTypes: a.ImageTypes,
+		Dir:        a.Env.ImageDir,
+		Env:        a.Env,
 	}
 
 	err = fileLib.Validate()
 	if err != nil {
 		response.Err = err.Error()
-		response.Code = 400
+		response.Code = fileErrorCode(err)
 		response.Json()
 		return
 	}
@@ -317,9 +428,8 @@ func (a *Video) UpdateCover(w http.ResponseWriter, r *http.Request) {
 		response.Json()
 		return
 	}
-	path := a.Env.BaseDir + a.Env.ImageDir + *(video.Cover)
-	if _, err := os.Stat(path); err == nil {
-		err = os.Remove(path)
+	if video.Cover != nil {
+		err = fileLib.Remove(*video.Cover)
 	}
 
 	if err != nil {
@@ -341,7 +451,7 @@ func (a *Video) UpdateCover(w http.ResponseWriter, r *http.Request) {
 	}
 
 	response.Code = 200
-	response.Data = a.Env.AppURL + a.Env.ImageDir + image
+	response.Data = signedURL(a.Env, a.Media, a.Env.ImageDir, image, nil)
 	response.Json()
 
 }
@@ -368,12 +478,16 @@ func (a *Video) CreateSrc(w http.ResponseWriter, r *http.Request) {
 		response.Json()
 		return
 	}
+	if !authorizeCourse(a.Env, response, r, video.CourseID, false) {
+		return
+	}
 
+	limitUpload(w, r, a.VideoTypes)
 	file, header, err := r.FormFile("file")
 
 	if err != nil {
 		response.Err = err.Error()
-		response.Code = 400
+		response.Code = fileErrorCode(err)
 		response.Json()
 		return
 	}
@@ -382,13 +496,14 @@ func (a *Video) CreateSrc(w http.ResponseWriter, r *http.Request) {
 		File:       file,
 		Header:     header,
 		Prefix:     "video_src_",
-		ValidTypes: validVideoFileTypes,
-		Path:       a.Env.BaseDir + a.Env.VideoDir,
+		ValidTypes: a.VideoTypes,
+		Dir:        a.Env.VideoDir,
+		Env:        a.Env,
 	}
 	err = fileLib.Validate()
 	if err != nil {
 		response.Err = err.Error()
-		response.Code = 400
+		response.Code = fileErrorCode(err)
 		response.Json()
 		return
 	}
@@ -413,7 +528,7 @@ func (a *Video) CreateSrc(w http.ResponseWriter, r *http.Request) {
 	}
 
 	response.Code = 200
-	response.Data = a.Env.AppURL + a.Env.VideoDir + videoPath
+	response.Data = a.srcURL(w, r, video)
 	response.Json()
 
 }
@@ -440,12 +555,16 @@ func (a *Video) UpdateSrc(w http.ResponseWriter, r *http.Request) {
 		response.Json()
 		return
 	}
+	if !authorizeCourse(a.Env, response, r, video.CourseID, false) {
+		return
+	}
 
+	limitUpload(w, r, a.VideoTypes)
 	file, header, err := r.FormFile("file")
 
 	if err != nil {
 		response.Err = err.Error()
-		response.Code = 400
+		response.Code = fileErrorCode(err)
 		response.Json()
 		return
 	}
@@ -454,14 +573,15 @@ func (a *Video) UpdateSrc(w http.ResponseWriter, r *http.Request) {
 		File:       file,
 		Header:     header,
 		Prefix:     "video_src_",
-		ValidTypes: validVideoFileTypes,
-		Path:       a.Env.BaseDir + a.Env.VideoDir,
+		ValidTypes: a.VideoTypes,
+		Dir:        a.Env.VideoDir,
+		Env:        a.Env,
 	}
 
 	err = fileLib.Validate()
 	if err != nil {
 		response.Err = err.Error()
-		response.Code = 400
+		response.Code = fileErrorCode(err)
 		response.Json()
 		return
 	}
@@ -473,10 +593,8 @@ func (a *Video) UpdateSrc(w http.ResponseWriter, r *http.Request) {
 		response.Json()
 		return
 	}
-	path := a.Env.BaseDir + a.Env.VideoDir + *(video.Src)
-
-	if _, err := os.Stat(path); err == nil {
-		err = os.Remove(path)
+	if video.Src != nil {
+		err = fileLib.Remove(*video.Src)
 	}
 
 	if err != nil {
@@ -498,7 +616,183 @@ func (a *Video) UpdateSrc(w http.ResponseWriter, r *http.Request) {
 	}
 
 	response.Code = 200
-	response.Data = a.Env.AppURL + a.Env.VideoDir + videoPath
+	response.Data = a.srcURL(w, r, video)
+	response.Json()
+
+}
+
+// ReportProgress is called periodically by the player with the current
+// position and the seconds watched since its previous report.
+func (a *Video) ReportProgress(w http.ResponseWriter, r *http.Request) {
+	response := &Response{W: w}
+	identity, _ := auth.FromContext(r.Context())
+	vars := mux.Vars(r)
+
+	ID, err := strconv.ParseInt(vars["id"], 10, 64)
+	if err != nil {
+		response.Err = err.Error()
+		response.Code = 400
+		response.Json()
+		return
+	}
+
+	report := progressReport{}
+	if err := json.NewDecoder(r.Body).Decode(&report); err != nil {
+		response.Err = err.Error()
+		response.Code = 400
+		response.Json()
+		return
+	}
+
+	video := &model.Video{Env: a.Env}
+	video, err = video.GetByID(ID)
+	if err != nil {
+		response.Err = err.Error()
+		response.Code = 404
+		response.Json()
+		return
+	}
+
+	if !identity.IsAdmin {
+		available, err := video.IsAvailable()
+		if err != nil {
+			response.Err = err.Error()
+			response.Code = 400
+			response.Json()
+			return
+		}
+		if !available {
+			response.Err = "there is no such video"
+			response.Code = 404
+			response.Json()
+			return
+		}
+
+		enrollment := &model.Enrollment{Env: a.Env}
+		enrolled, err := enrollment.IsActive(identity.ID, video.CourseID)
+		if err != nil {
+			response.Err = err.Error()
+			response.Code = 400
+			response.Json()
+			return
+		}
+		if !enrolled {
+			response.Err = model.ErrNotEnrolled.Error()
+			response.Code = 403
+			response.Json()
+			return
+		}
+	}
+
+	// completion is measured against the duration, a learner's player could
+	// report anything so only an admin's fills it in
+	if identity.IsAdmin && video.Duration == nil && report.Duration > 0 {
+		if err := video.SetDuration(report.Duration); err != nil {
+			response.Err = err.Error()
+			response.Code = 400
+			response.Json()
+			return
+		}
+	}
+
+	progress := &model.VideoProgress{Env: a.Env}
+	progress, err = progress.Report(identity.ID, video, report.Position, report.Watched, a.CompletionThreshold)
+	if err != nil {
+		response.Err = err.Error()
+		response.Code = 400
+		response.Json()
+		return
+	}
+
+	response.Code = 200
+	response.Data = progress
+	response.Json()
+}
+
+func (a *Video) ChangeStatus(w http.ResponseWriter, r *http.Request) {
+	response := &Response{W: w}
+	vars := mux.Vars(r)
+
+	ID, err := strconv.ParseInt(vars["id"], 10, 64)
+	if err != nil {
+		response.Err = err.Error()
+		response.Code = 400
+		response.Json()
+		return
+	}
+
+	transition := &model.Transition{}
+	if err := json.NewDecoder(r.Body).Decode(transition); err != nil {
+		response.Err = err.Error()
+		response.Code = 400
+		response.Json()
+		return
+	}
+	if !authorizeTransition(response, r, transition) || !a.authorize(response, r, ID) {
+		return
+	}
+
+	video := &model.Video{Env: a.Env, ID: ID}
+	if err := video.ChangeStatus(transition); err != nil {
+		response.Err = err.Error()
+		response.Code = transitionErrorCode(err)
+		response.Json()
+		return
+	}
+
+	video, err = video.GetByID(ID)
+	if err != nil {
+		response.Err = err.Error()
+		response.Code = 400
+		response.Json()
+		return
+	}
+
+	response.Code = 200
+	response.Data = video
+	response.Json()
+}
+
+func (a *Video) Restore(w http.ResponseWriter, r *http.Request) {
+	response := &Response{W: w}
+	vars := mux.Vars(r)
+
+	ID, err := strconv.ParseInt(vars["id"], 10, 64)
+	if err != nil {
+		response.Err = err.Error()
+		response.Code = 400
+		response.Json()
+		return
+	}
+
+	video := &model.Video{Env: a.Env, ID: ID}
+	err = video.Restore()
+	if err == sql.ErrNoRows {
+		response.Err = "there is no such video in the trash"
+		response.Code = 404
+		response.Json()
+		return
+	} else if err != nil {
+		response.Err = err.Error()
+		response.Code = 400
+		response.Json()
+		return
+	}
+
+	response.Code = 200
+	response.Data = ID
 	response.Json()
+}
 
+// authorize checks the caller teaches the course the video belongs to.
+func (a *Video) authorize(response *Response, r *http.Request, ID int64) bool {
+	video := &model.Video{Env: a.Env}
+	video, err := video.GetByID(ID)
+	if err != nil {
+		response.Err = "there is no such video"
+		response.Code = 404
+		response.Json()
+		return false
+	}
+	return authorizeCourse(a.Env, response, r, video.CourseID, false)
 }
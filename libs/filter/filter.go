@@ -4,6 +4,7 @@ import (
 	"errors"
 	"reflect"
 	"regexp"
+	"strconv"
 	"strings"
 
 	"github.com/arizanovj/courses/env"
@@ -20,12 +21,17 @@ const (
 	LessThanOrEqualTo    = "lte"
 	GreaterThan          = "gt"
 	GreaterThanOrEqualTo = "gte"
+	In                   = "in"
+	Any                  = "any"
+	All                  = "all"
 )
 
 var Types = [...]string{
 	"number",
 	"date",
 	"string",
+	"tree",
+	"tags",
 }
 
 var NumberFilters = []string{
@@ -45,6 +51,24 @@ var StringFilters = []string{
 	ContainsStart,
 	EqualTo,
 }
+
+// TreeFilters apply to a column referencing a table with an id and a
+// parent_id column, named by the third part of the tag. In also matches
+// every descendant of the given node.
+var TreeFilters = []string{
+	EqualTo,
+	In,
+}
+
+// TagsFilters apply to a many to many relation with tag, the third part of
+// the tag names the join table and its column for the model's id, then the
+// model's table and id, e.g. "course_tag.course_id=course.id". Values are
+// comma separated tag names.
+var TagsFilters = []string{
+	Any,
+	All,
+}
+
 var FromDateFilters = []string{
 	EqualTo,
 	GreaterThan,
@@ -74,7 +98,14 @@ func (f *Filter) Filterize(query *goqu.Dataset) *goqu.Dataset {
 		v := strings.Split(value[0], "|")
 
 		if len(k) == 1 && f.validateField(k[0], v) {
-			query = query.Where(f.getQuery(string(k[0]), string(v[0]), string(v[1])))
+			switch f.getFieldTypeFromTag(k[0]) {
+			case "tree":
+				query = query.Where(f.getTreeQuery(k[0], v[0], v[1]))
+			case "tags":
+				query = query.Where(f.getTagsQuery(k[0], v[0], v[1]))
+			default:
+				query = query.Where(f.getQuery(string(k[0]), string(v[0]), string(v[1])))
+			}
 
 		} else if f.validateDateField(k, v) {
 			query = query.Where(f.getQuery(string(k[0]), string(v[0]), string(v[1])))
@@ -121,6 +152,14 @@ func (f *Filter) validateField(key string, value []string) bool {
 		return true
 	}
 
+	if fieldType == "tree" && stringInSlice(value[0], TreeFilters) {
+		return true
+	}
+
+	if fieldType == "tags" && stringInSlice(value[0], TagsFilters) {
+		return true
+	}
+
 	f.Errors = append(f.Errors, errors.New("invalid data per "+key))
 	return false
 }
@@ -148,6 +187,98 @@ func (f *Filter) getQuery(field string, filter string, value string) goqu.Expres
 	return goqu.I("1").Eq("1")
 }
 
+func (f *Filter) getTreeQuery(field string, filter string, value string) goqu.Expression {
+	if filter == EqualTo {
+		return goqu.I(field).Eq(value)
+	}
+	root, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		f.Errors = append(f.Errors, errors.New("invalid node "+value))
+		return goqu.L("1 = 0")
+	}
+
+	children := make(map[int64][]int64)
+	rows, err := f.Env.DB.Query("SELECT id, parent_id FROM `" + f.getFieldRelationFromTag(field) + "` WHERE parent_id IS NOT NULL")
+	if err != nil {
+		f.Errors = append(f.Errors, err)
+		return goqu.L("1 = 0")
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var ID, parentID int64
+		if err := rows.Scan(&ID, &parentID); err != nil {
+			f.Errors = append(f.Errors, err)
+			return goqu.L("1 = 0")
+		}
+		children[parentID] = append(children[parentID], ID)
+	}
+
+	IDs := []interface{}{}
+	seen := make(map[int64]bool)
+	queue := []int64{root}
+	for len(queue) > 0 {
+		ID := queue[0]
+		queue = queue[1:]
+		if seen[ID] {
+			continue
+		}
+		seen[ID] = true
+		IDs = append(IDs, ID)
+		queue = append(queue, children[ID]...)
+	}
+	return goqu.I(field).In(IDs...)
+}
+
+func (f *Filter) getTagsQuery(field string, filter string, value string) goqu.Expression {
+	var table, key, modelTable, modelKey string
+	relation := strings.Split(f.getFieldRelationFromTag(field), "=")
+	if len(relation) == 2 {
+		join, model := strings.SplitN(relation[0], ".", 2), strings.SplitN(relation[1], ".", 2)
+		if len(join) == 2 && len(model) == 2 {
+			table, key, modelTable, modelKey = join[0], join[1], model[0], model[1]
+		}
+	}
+	if table == "" {
+		f.Errors = append(f.Errors, errors.New("invalid tag relation for "+field))
+		return goqu.L("1 = 0")
+	}
+
+	// duplicates would never all be matched by HAVING below
+	names := []interface{}{}
+	placeholders := []string{}
+	seen := make(map[string]bool)
+	for _, name := range strings.Split(value, ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name != "" && !seen[name] {
+			seen[name] = true
+			names = append(names, name)
+			placeholders = append(placeholders, "?")
+		}
+	}
+	if len(names) == 0 {
+		return goqu.L("1 = 1")
+	}
+
+	subquery := "SELECT j.`" + key + "` FROM `" + table + "` j JOIN tag t ON t.id = j.tag_id WHERE t.name IN (" + strings.Join(placeholders, ",") + ")"
+	if filter == All {
+		subquery += " GROUP BY j.`" + key + "` HAVING COUNT(DISTINCT t.id) = " + strconv.Itoa(len(names))
+	}
+	return goqu.L("`"+modelTable+"`.`"+modelKey+"` IN ("+subquery+")", names...)
+}
+
+// getFieldRelationFromTag returns the third part of the filter tag.
+func (f *Filter) getFieldRelationFromTag(field string) string {
+	t := reflect.TypeOf(f.Model)
+
+	for i := 0; i < t.NumField(); i++ {
+		filterTag := strings.Split(t.Field(i).Tag.Get(tagName), ",")
+		if len(filterTag) == 3 && filterTag[0] == field {
+			return filterTag[2]
+		}
+	}
+	return ""
+}
+
 func (f *Filter) getFieldTypeFromTag(field string) string {
 	t := reflect.TypeOf(f.Model)
 
@@ -202,6 +333,9 @@ func (f *Filter) GetFilters() []string {
 		LessThanOrEqualTo,
 		GreaterThan,
 		GreaterThanOrEqualTo,
+		In,
+		Any,
+		All,
 	}
 	return s
 }
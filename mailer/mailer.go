@@ -0,0 +1,65 @@
+package mailer
+
+import (
+	"fmt"
+	"net/smtp"
+	"strings"
+	"sync"
+)
+
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+type Mailer interface {
+	Send(*Message) error
+}
+
+type SMTP struct {
+	Host     string
+	Port     string
+	Username string
+	Password string
+	From     string
+}
+
+func (s *SMTP) Send(m *Message) error {
+	var auth smtp.Auth
+	if s.Username != "" {
+		auth = smtp.PlainAuth("", s.Username, s.Password, s.Host)
+	}
+	headers := []string{
+		"From: " + s.From,
+		"To: " + m.To,
+		"Subject: " + m.Subject,
+		"MIME-Version: 1.0",
+		"Content-Type: text/plain; charset=UTF-8",
+	}
+	msg := strings.Join(headers, "\r\n") + "\r\n\r\n" + m.Body
+	return smtp.SendMail(fmt.Sprintf("%s:%s", s.Host, s.Port), auth, s.From, []string{m.To}, []byte(msg))
+}
+
+// Memory keeps sent messages instead of delivering them, for tests and
+// local development.
+type Memory struct {
+	mu       sync.Mutex
+	Messages []*Message
+}
+
+func (m *Memory) Send(msg *Message) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.Messages = append(m.Messages, msg)
+	return nil
+}
+
+func (m *Memory) Last() *Message {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if len(m.Messages) == 0 {
+		return nil
+	}
+	return m.Messages[len(m.Messages)-1]
+}
@@ -1,15 +1,22 @@
 package main
 
 import (
+	"crypto/rand"
 	"database/sql"
 	"fmt"
 	"log"
 	"net/http"
 	"os"
+	"os/signal"
 	"os/user"
+	"syscall"
+	"time"
 
 	"github.com/arizanovj/courses/auth"
 	"github.com/arizanovj/courses/env"
+	"github.com/arizanovj/courses/mailer"
+	"github.com/arizanovj/courses/model"
+	"github.com/arizanovj/courses/storage"
 	"github.com/gorilla/mux"
 
 	"github.com/arizanovj/courses/handler"
@@ -56,9 +63,6 @@ func main() {
 	if !viper.IsSet("db.dialect") {
 		log.Fatal("missing db dialect")
 	}
-	if !viper.IsSet("jwt.publicKey") {
-		log.Fatal("missing jwt public key")
-	}
 
 	dbUser := viper.GetString("db.user")
 	dbPassword := viper.GetString("db.password")
@@ -66,7 +70,19 @@ func main() {
 	dbPort := viper.GetString("db.port")
 	dbInstance := viper.GetString("db.instance")
 	dbDialect := viper.GetString("db.dialect")
-	jwtPubkey := viper.GetString("jwt.publicKey")
+	jwtKeysDir := "keys"
+	if viper.IsSet("jwt.keysDir") {
+		jwtKeysDir = viper.GetString("jwt.keysDir")
+	}
+
+	accessTTL := time.Hour
+	if viper.IsSet("jwt.accessTTL") {
+		accessTTL = viper.GetDuration("jwt.accessTTL")
+	}
+	refreshTTL := 30 * 24 * time.Hour
+	if viper.IsSet("jwt.refreshTTL") {
+		refreshTTL = viper.GetDuration("jwt.refreshTTL")
+	}
 
 	db, err := sql.Open(dbDialect, dbUser+":"+dbPassword+"@tcp("+dbHostname+":"+dbPort+")/"+dbInstance+"?charset=utf8&parseTime=True")
 	if err != nil {
@@ -80,70 +96,627 @@ func main() {
 	// bytes, err := bcrypt.GenerateFromPassword([]byte("111223344"), 14)
 	// fmt.Printf("%+v\n", string(bytes))
 	qb := goqu.New(dbDialect, db)
+
+	// signups can't be verified without emails, running without delivering
+	// them has to be asked for with mailer: memory
+	var mail mailer.Mailer
+	switch {
+	case viper.IsSet("smtp.host"):
+		mail = &mailer.SMTP{
+			Host:     viper.GetString("smtp.host"),
+			Port:     viper.GetString("smtp.port"),
+			Username: viper.GetString("smtp.username"),
+			Password: viper.GetString("smtp.password"),
+			From:     viper.GetString("smtp.from"),
+		}
+	case viper.GetString("mailer") == "memory":
+		log.Println("mailer is memory, emails will not be delivered")
+		mail = &mailer.Memory{}
+	default:
+		log.Fatal("smtp.host is not configured, set mailer: memory to run without delivering emails")
+	}
+
+	var store storage.Storage
+	switch viper.GetString("storage.driver") {
+	case "s3":
+		s3 := &storage.S3{
+			Endpoint:  viper.GetString("storage.s3.endpoint"),
+			Region:    viper.GetString("storage.s3.region"),
+			Bucket:    viper.GetString("storage.s3.bucket"),
+			AccessKey: viper.GetString("storage.s3.accessKey"),
+			SecretKey: viper.GetString("storage.s3.secretKey"),
+		}
+		if s3.Region == "" {
+			s3.Region = "us-east-1"
+		}
+		store = s3
+	case "", "local":
+		store = &storage.Local{Dir: wd}
+	default:
+		log.Fatalf("unknown storage.driver %q", viper.GetString("storage.driver"))
+	}
 	env := env.Env{
-		DB:       db,
-		QB:       qb,
-		BaseDir:  wd,
-		AppURL:   "http://localhost:9001",
-		ImageDir: "/static/image/",
-		VideoDir: "/static/video/",
+		DB:        db,
+		QB:        qb,
+		BaseDir:   wd,
+		AppURL:    "http://localhost:9001",
+		ImageDir:  "/static/image/",
+		VideoDir:  "/static/video/",
+		UploadDir: "/uploads/",
+		Mailer:    mail,
+		Storage:   store,
 	}
+	keys, err := auth.NewKeyManager(configDir+jwtKeysDir, viper.GetString("jwt.activeKey"), viper.GetStringSlice("jwt.retiredKeys"))
+	if err != nil {
+		log.Fatal(err)
+	}
+	reload := make(chan os.Signal, 1)
+	signal.Notify(reload, syscall.SIGHUP)
+	go func() {
+		for range reload {
+			if err := keys.Load(); err != nil {
+				log.Printf("reloading jwt keys: %s", err)
+			}
+		}
+	}()
+
 	j := &auth.Jwt{
-		PublicKeyPath: configDir + jwtPubkey,
+		Keys:     keys,
+		APIKeys:  &model.APIKeyStore{Env: &env},
+		Sessions: &model.SessionStore{Env: &env},
+		TTL:      accessTTL,
+	}
+	throttle := &model.LoginThrottle{
+		Env:              &env,
+		AccountThreshold: 5,
+		IPThreshold:      50,
+		BaseLockout:      time.Minute,
+		MaxLockout:       time.Hour,
+		Window:           time.Hour,
+	}
+	if viper.IsSet("login.accountThreshold") {
+		throttle.AccountThreshold = viper.GetInt("login.accountThreshold")
+	}
+	if viper.IsSet("login.ipThreshold") {
+		throttle.IPThreshold = viper.GetInt("login.ipThreshold")
+	}
+	if viper.IsSet("login.baseLockout") {
+		throttle.BaseLockout = viper.GetDuration("login.baseLockout")
+	}
+	if viper.IsSet("login.maxLockout") {
+		throttle.MaxLockout = viper.GetDuration("login.maxLockout")
+	}
+
+	emailThrottle := &model.EmailThrottle{
+		Env:        &env,
+		EmailLimit: 3,
+		IPLimit:    20,
+		Window:     time.Hour,
+	}
+	if viper.IsSet("emailThrottle.emailLimit") {
+		emailThrottle.EmailLimit = viper.GetInt("emailThrottle.emailLimit")
+	}
+	if viper.IsSet("emailThrottle.ipLimit") {
+		emailThrottle.IPLimit = viper.GetInt("emailThrottle.ipLimit")
+	}
+	if viper.IsSet("emailThrottle.window") {
+		emailThrottle.Window = viper.GetDuration("emailThrottle.window")
+	}
+
+	mfa := &model.MFA{Env: &env, Issuer: "Courses"}
+	if viper.IsSet("mfa.issuer") {
+		mfa.Issuer = viper.GetString("mfa.issuer")
+	}
+
+	var oidc *auth.OIDC
+	if viper.IsSet("oidc.issuer") {
+		oidc = &auth.OIDC{
+			Issuer:       viper.GetString("oidc.issuer"),
+			ClientID:     viper.GetString("oidc.clientID"),
+			ClientSecret: viper.GetString("oidc.clientSecret"),
+			RedirectURL:  viper.GetString("oidc.redirectURL"),
+		}
+	}
+
+	authHandler := &handler.Auth{
+		Env:             &env,
+		Jwt:             j,
+		Throttle:        throttle,
+		EmailThrottle:   emailThrottle,
+		MFA:             mfa,
+		OIDC:            oidc,
+		RequireAdminMFA: viper.GetBool("mfa.requireForAdmins"),
+		RefreshTTL:      refreshTTL,
+	}
+
+	mediaKeys := make(map[string][]byte)
+	for kid, secret := range viper.GetStringMapString("media.keys") {
+		mediaKeys[kid] = []byte(secret)
+	}
+	mediaActive := viper.GetString("media.activeKey")
+	if len(mediaKeys) == 0 {
+		log.Println("media.keys is not configured, media links will not survive a restart")
+		secret := make([]byte, 32)
+		if _, err := rand.Read(secret); err != nil {
+			log.Fatal(err)
+		}
+		mediaActive = "ephemeral"
+		mediaKeys[mediaActive] = secret
+	}
+	mediaTTL := time.Hour
+	if viper.IsSet("media.ttl") {
+		mediaTTL = viper.GetDuration("media.ttl")
+	}
+	media, err := auth.NewMediaSigner(mediaKeys, mediaActive, mediaTTL)
+	if err != nil {
+		log.Fatal("media.activeKey: ", err)
+	}
+	media.BindUser = viper.GetBool("media.bindUser")
+
+	// files are recognized by their content, upload.limits overrides the
+	// largest size allowed for a type, e.g. upload.limits.image/png
+	imageTypes := map[string]int64{"image/png": 5 << 20, "image/jpeg": 5 << 20, "image/webp": 5 << 20}
+	videoTypes := map[string]int64{"video/mp4": 10 << 30, "video/webm": 10 << 30}
+	for _, types := range []map[string]int64{imageTypes, videoTypes} {
+		for mime := range types {
+			if viper.IsSet("upload.limits." + mime) {
+				types[mime] = viper.GetInt64("upload.limits." + mime)
+			}
+		}
 	}
-	authHandler := &handler.Auth{Env: &env}
 
-	courseHandle := &handler.Course{Env: &env}
-	videoHandle := &handler.Video{Env: &env}
+	if err := os.MkdirAll(wd+env.UploadDir, 0755); err != nil {
+		log.Fatal(err)
+	}
+	uploadHandle := &handler.Upload{Env: &env, MaxSize: 10 << 30, Expiry: 24 * time.Hour, Types: videoTypes}
+	if viper.IsSet("upload.maxSize") {
+		uploadHandle.MaxSize = viper.GetInt64("upload.maxSize")
+	}
+	if viper.IsSet("upload.expiry") {
+		uploadHandle.Expiry = viper.GetDuration("upload.expiry")
+	}
+	go func() {
+		sweeper := &model.Upload{Env: &env}
+		for range time.Tick(time.Hour) {
+			swept, err := sweeper.Sweep()
+			if err != nil {
+				log.Printf("sweeping uploads: %s", err)
+				continue
+			}
+			if swept > 0 {
+				log.Printf("removed %d expired uploads", swept)
+			}
+		}
+	}()
+
+	purger := &model.Purger{Env: &env, Retention: 30 * 24 * time.Hour}
+	if viper.IsSet("purge.retention") {
+		purger.Retention = viper.GetDuration("purge.retention")
+	}
+	purgeInterval := time.Hour
+	if viper.IsSet("purge.interval") {
+		purgeInterval = viper.GetDuration("purge.interval")
+	}
+	go func() {
+		for range time.Tick(purgeInterval) {
+			result, err := purger.Purge()
+			if err != nil {
+				log.Printf("purging trash: %s", err)
+				continue
+			}
+			if result.Courses+result.Videos+result.Users > 0 {
+				log.Printf("purged %d courses, %d videos and %d users from the trash", result.Courses, result.Videos, result.Users)
+			}
+		}
+	}()
+
+	courseHandle := &handler.Course{Env: &env, Media: media, ImageTypes: imageTypes}
+	completionThreshold := 0.9
+	if viper.IsSet("progress.completionThreshold") {
+		completionThreshold = viper.GetFloat64("progress.completionThreshold")
+	}
+	videoHandle := &handler.Video{Env: &env, CompletionThreshold: completionThreshold, Media: media, ImageTypes: imageTypes, VideoTypes: videoTypes}
+	mediaHandle := &handler.Media{Env: &env, Signer: media}
 	usersHandle := &handler.User{Env: &env}
+	apiKeyHandle := &handler.APIKey{Env: &env}
+	sessionHandle := &handler.Session{Env: &env}
+	enrollmentHandle := &handler.Enrollment{Env: &env, Media: media}
+	sectionHandle := &handler.Section{Env: &env, Media: media}
+	categoryHandle := &handler.Category{Env: &env}
+	tagHandle := &handler.Tag{Env: &env}
+	instructorHandle := &handler.Instructor{Env: &env, Media: media}
+	prerequisiteHandle := &handler.Prerequisite{Env: &env, Media: media}
+	pathHandle := &handler.Path{Env: &env, Media: media}
 	resp := &handler.Response{}
-	r := mux.NewRouter().PathPrefix("v1").Subrouter()
+	router := mux.NewRouter()
+	router.Handle("/.well-known/jwks.json", negroni.New(
+		negroni.HandlerFunc(resp.CORS),
+		negroni.Wrap(http.HandlerFunc(authHandler.JWKS)),
+	)).Methods("GET", "OPTIONS")
+
+	r := router.PathPrefix("/v1").Subrouter()
 	r.Handle("/auth/login/", negroni.New(
 		negroni.HandlerFunc(resp.CORS),
+		negroni.HandlerFunc(j.Require(auth.Anonymous)),
 		negroni.Wrap(http.HandlerFunc(authHandler.Login)),
 	))
+	r.Handle("/auth/refresh/", negroni.New(
+		negroni.HandlerFunc(resp.CORS),
+		negroni.HandlerFunc(j.Require(auth.Anonymous)),
+		negroni.Wrap(http.HandlerFunc(authHandler.Refresh)),
+	)).Methods("POST", "OPTIONS")
+	r.Handle("/auth/logout/", negroni.New(
+		negroni.HandlerFunc(resp.CORS),
+		negroni.HandlerFunc(j.Require(auth.Anonymous)),
+		negroni.Wrap(http.HandlerFunc(authHandler.Logout)),
+	)).Methods("POST", "OPTIONS")
+	r.Handle("/auth/signup/", negroni.New(
+		negroni.HandlerFunc(resp.CORS),
+		negroni.HandlerFunc(j.Require(auth.Anonymous)),
+		negroni.Wrap(http.HandlerFunc(authHandler.Signup)),
+	)).Methods("POST", "OPTIONS")
+	r.Handle("/auth/verify/", negroni.New(
+		negroni.HandlerFunc(resp.CORS),
+		negroni.HandlerFunc(j.Require(auth.Anonymous)),
+		negroni.Wrap(http.HandlerFunc(authHandler.VerifyEmail)),
+	)).Methods("GET", "OPTIONS")
+	r.Handle("/auth/verify/resend/", negroni.New(
+		negroni.HandlerFunc(resp.CORS),
+		negroni.HandlerFunc(j.Require(auth.Anonymous)),
+		negroni.Wrap(http.HandlerFunc(authHandler.ResendVerification)),
+	)).Methods("POST", "OPTIONS")
+	r.Handle("/auth/password/forgot", negroni.New(
+		negroni.HandlerFunc(resp.CORS),
+		negroni.HandlerFunc(j.Require(auth.Anonymous)),
+		negroni.Wrap(http.HandlerFunc(authHandler.ForgotPassword)),
+	)).Methods("POST", "OPTIONS")
+	r.Handle("/auth/password/reset", negroni.New(
+		negroni.HandlerFunc(resp.CORS),
+		negroni.HandlerFunc(j.Require(auth.Anonymous)),
+		negroni.Wrap(http.HandlerFunc(authHandler.ResetPassword)),
+	)).Methods("POST", "OPTIONS")
+	r.Handle("/auth/mfa/enroll", negroni.New(
+		negroni.HandlerFunc(resp.CORS),
+		negroni.HandlerFunc(j.Require(auth.MFAEnrollment)),
+		negroni.Wrap(http.HandlerFunc(authHandler.MFAEnroll)),
+	)).Methods("POST", "OPTIONS")
+	r.Handle("/auth/mfa/confirm", negroni.New(
+		negroni.HandlerFunc(resp.CORS),
+		negroni.HandlerFunc(j.Require(auth.MFAEnrollment)),
+		negroni.Wrap(http.HandlerFunc(authHandler.MFAConfirm)),
+	)).Methods("POST", "OPTIONS")
+	r.Handle("/auth/mfa/verify", negroni.New(
+		negroni.HandlerFunc(resp.CORS),
+		negroni.HandlerFunc(j.Require(auth.MFAPending)),
+		negroni.Wrap(http.HandlerFunc(authHandler.MFAVerify)),
+	)).Methods("POST", "OPTIONS")
+	if oidc != nil {
+		r.Handle("/auth/oidc/login", negroni.New(
+			negroni.HandlerFunc(resp.CORS),
+			negroni.HandlerFunc(j.Require(auth.Anonymous)),
+			negroni.Wrap(http.HandlerFunc(authHandler.OIDCLogin)),
+		)).Methods("GET", "OPTIONS")
+		r.Handle("/auth/oidc/callback", negroni.New(
+			negroni.HandlerFunc(resp.CORS),
+			negroni.HandlerFunc(j.Require(auth.Anonymous)),
+			negroni.Wrap(http.HandlerFunc(authHandler.OIDCCallback)),
+		)).Methods("POST", "OPTIONS")
+		r.Handle("/auth/oidc/link", negroni.New(
+			negroni.HandlerFunc(resp.CORS),
+			negroni.HandlerFunc(j.Require(auth.Authenticated)),
+			negroni.Wrap(http.HandlerFunc(authHandler.OIDCLinkBegin)),
+		)).Methods("GET", "OPTIONS")
+		r.Handle("/auth/oidc/link", negroni.New(
+			negroni.HandlerFunc(resp.CORS),
+			negroni.HandlerFunc(j.Require(auth.Authenticated)),
+			negroni.Wrap(http.HandlerFunc(authHandler.OIDCLink)),
+		)).Methods("POST", "OPTIONS")
+	}
 	r.Handle("/auth/private/", negroni.New(
-		negroni.HandlerFunc(j.Validate),
+		negroni.HandlerFunc(resp.CORS),
+		negroni.HandlerFunc(j.Require(auth.Authenticated)),
 		negroni.Wrap(http.HandlerFunc(authHandler.Private)),
 	))
 	r.Handle("/courses/", negroni.New(
 		negroni.HandlerFunc(resp.CORS),
+		negroni.HandlerFunc(j.Require(auth.Anonymous)),
 		negroni.Wrap(http.HandlerFunc(courseHandle.All)),
 	)).Methods("GET", "OPTIONS")
 
 	r.Handle("/courses/{id}", negroni.New(
 		negroni.HandlerFunc(resp.CORS),
+		negroni.HandlerFunc(j.Require(auth.Anonymous)),
 		negroni.Wrap(http.HandlerFunc(courseHandle.Get)),
 	)).Methods("GET", "OPTIONS")
 
 	r.Handle("/courses/{id}", negroni.New(
 		negroni.HandlerFunc(resp.CORS),
+		negroni.HandlerFunc(j.Require(auth.Authenticated)),
 		negroni.Wrap(http.HandlerFunc(courseHandle.Update)),
 	)).Methods("PUT", "OPTIONS")
 
 	r.Handle("/courses/{id}", negroni.New(
 		negroni.HandlerFunc(resp.CORS),
+		negroni.HandlerFunc(j.Require(auth.Authenticated)),
 		negroni.Wrap(http.HandlerFunc(courseHandle.Delete)),
 	)).Methods("DELETE", "OPTIONS")
 
 	r.Handle("/courses/", negroni.New(
 		negroni.HandlerFunc(resp.CORS),
+		negroni.HandlerFunc(j.Require(auth.Authenticated)),
 		negroni.Wrap(http.HandlerFunc(courseHandle.Create)),
 	)).Methods("POST", "OPTIONS")
 
 	r.Handle("/courses/{id}/cover", negroni.New(
 		negroni.HandlerFunc(resp.CORS),
+		negroni.HandlerFunc(j.Require(auth.Authenticated)),
 		negroni.Wrap(http.HandlerFunc(courseHandle.CreateCover)),
 	)).Methods("POST", "OPTIONS")
 
 	r.Handle("/courses/{id}/cover", negroni.New(
 		negroni.HandlerFunc(resp.CORS),
+		negroni.HandlerFunc(j.Require(auth.Authenticated)),
 		negroni.Wrap(http.HandlerFunc(courseHandle.UpdateCover)),
 	)).Methods("PUT", "OPTIONS")
 
+	r.Handle("/courses/{id}/restore", negroni.New(
+		negroni.HandlerFunc(resp.CORS),
+		negroni.HandlerFunc(j.Require(auth.Admin)),
+		negroni.Wrap(http.HandlerFunc(courseHandle.Restore)),
+	)).Methods("POST", "OPTIONS")
+
+	r.Handle("/courses/{id}/status", negroni.New(
+		negroni.HandlerFunc(resp.CORS),
+		negroni.HandlerFunc(j.Require(auth.Authenticated)),
+		negroni.Wrap(http.HandlerFunc(courseHandle.ChangeStatus)),
+	)).Methods("POST", "OPTIONS")
+
+	r.Handle("/courses/{id}/sections/", negroni.New(
+		negroni.HandlerFunc(resp.CORS),
+		negroni.HandlerFunc(j.Require(auth.Anonymous)),
+		negroni.Wrap(http.HandlerFunc(sectionHandle.All)),
+	)).Methods("GET", "OPTIONS")
+
+	r.Handle("/courses/{id}/sections/", negroni.New(
+		negroni.HandlerFunc(resp.CORS),
+		negroni.HandlerFunc(j.Require(auth.Authenticated)),
+		negroni.Wrap(http.HandlerFunc(sectionHandle.Create)),
+	)).Methods("POST", "OPTIONS")
+
+	r.Handle("/courses/{id}/syllabus", negroni.New(
+		negroni.HandlerFunc(resp.CORS),
+		negroni.HandlerFunc(j.Require(auth.Authenticated)),
+		negroni.Wrap(http.HandlerFunc(sectionHandle.Reorder)),
+	)).Methods("PUT", "OPTIONS")
+
+	r.Handle("/sections/{id}", negroni.New(
+		negroni.HandlerFunc(resp.CORS),
+		negroni.HandlerFunc(j.Require(auth.Authenticated)),
+		negroni.Wrap(http.HandlerFunc(sectionHandle.Update)),
+	)).Methods("PUT", "OPTIONS")
+
+	r.Handle("/sections/{id}", negroni.New(
+		negroni.HandlerFunc(resp.CORS),
+		negroni.HandlerFunc(j.Require(auth.Authenticated)),
+		negroni.Wrap(http.HandlerFunc(sectionHandle.Delete)),
+	)).Methods("DELETE", "OPTIONS")
+
+	r.Handle("/courses/{id}/prerequisites", negroni.New(
+		negroni.HandlerFunc(resp.CORS),
+		negroni.HandlerFunc(j.Require(auth.Anonymous)),
+		negroni.Wrap(http.HandlerFunc(prerequisiteHandle.Graph)),
+	)).Methods("GET", "OPTIONS")
+
+	r.Handle("/courses/{id}/prerequisites", negroni.New(
+		negroni.HandlerFunc(resp.CORS),
+		negroni.HandlerFunc(j.Require(auth.Authenticated)),
+		negroni.Wrap(http.HandlerFunc(prerequisiteHandle.Set)),
+	)).Methods("PUT", "OPTIONS")
+
+	r.Handle("/courses/{id}/instructors/", negroni.New(
+		negroni.HandlerFunc(resp.CORS),
+		negroni.HandlerFunc(j.Require(auth.Anonymous)),
+		negroni.Wrap(http.HandlerFunc(instructorHandle.All)),
+	)).Methods("GET", "OPTIONS")
+
+	r.Handle("/courses/{id}/instructors/{user_id}", negroni.New(
+		negroni.HandlerFunc(resp.CORS),
+		negroni.HandlerFunc(j.Require(auth.Authenticated)),
+		negroni.Wrap(http.HandlerFunc(instructorHandle.Save)),
+	)).Methods("PUT", "OPTIONS")
+
+	r.Handle("/courses/{id}/instructors/{user_id}", negroni.New(
+		negroni.HandlerFunc(resp.CORS),
+		negroni.HandlerFunc(j.Require(auth.Authenticated)),
+		negroni.Wrap(http.HandlerFunc(instructorHandle.Remove)),
+	)).Methods("DELETE", "OPTIONS")
+
+	r.Handle("/instructors/{id}", negroni.New(
+		negroni.HandlerFunc(resp.CORS),
+		negroni.HandlerFunc(j.Require(auth.Anonymous)),
+		negroni.Wrap(http.HandlerFunc(instructorHandle.Profile)),
+	)).Methods("GET", "OPTIONS")
+
+	r.Handle("/courses/{id}/enrollment", negroni.New(
+		negroni.HandlerFunc(resp.CORS),
+		negroni.HandlerFunc(j.Require(auth.Authenticated)),
+		negroni.Wrap(http.HandlerFunc(enrollmentHandle.Enroll)),
+	)).Methods("POST", "OPTIONS")
+
+	r.Handle("/courses/{id}/enrollment", negroni.New(
+		negroni.HandlerFunc(resp.CORS),
+		negroni.HandlerFunc(j.Require(auth.Authenticated)),
+		negroni.Wrap(http.HandlerFunc(enrollmentHandle.Unenroll)),
+	)).Methods("DELETE", "OPTIONS")
+
+	r.Handle("/courses/{id}/enrollments/", negroni.New(
+		negroni.HandlerFunc(resp.CORS),
+		negroni.HandlerFunc(j.Require(auth.Admin)),
+		negroni.Wrap(http.HandlerFunc(enrollmentHandle.Roster)),
+	)).Methods("GET", "OPTIONS")
+
+	r.Handle("/courses/{id}/progress", negroni.New(
+		negroni.HandlerFunc(resp.CORS),
+		negroni.HandlerFunc(j.Require(auth.Authenticated)),
+		negroni.Wrap(http.HandlerFunc(courseHandle.Progress)),
+	)).Methods("GET", "OPTIONS")
+
+	r.Handle("/videos/{id}/restore", negroni.New(
+		negroni.HandlerFunc(resp.CORS),
+		negroni.HandlerFunc(j.Require(auth.Admin)),
+		negroni.Wrap(http.HandlerFunc(videoHandle.Restore)),
+	)).Methods("POST", "OPTIONS")
+
+	r.Handle("/videos/{id}/status", negroni.New(
+		negroni.HandlerFunc(resp.CORS),
+		negroni.HandlerFunc(j.Require(auth.Authenticated)),
+		negroni.Wrap(http.HandlerFunc(videoHandle.ChangeStatus)),
+	)).Methods("POST", "OPTIONS")
+
+	r.Handle("/videos/{id}/stream", negroni.New(
+		negroni.HandlerFunc(resp.CORS),
+		negroni.HandlerFunc(j.Require(auth.Anonymous)),
+		negroni.Wrap(http.HandlerFunc(videoHandle.Stream)),
+	)).Methods("GET", "HEAD", "OPTIONS")
+
+	r.Handle("/videos/{id}/uploads/", negroni.New(
+		negroni.Wrap(http.HandlerFunc(uploadHandle.Options)),
+	)).Methods("OPTIONS")
+
+	r.Handle("/videos/{id}/uploads/", negroni.New(
+		negroni.HandlerFunc(resp.CORS),
+		negroni.HandlerFunc(j.Require(auth.Authenticated)),
+		negroni.Wrap(http.HandlerFunc(uploadHandle.Create)),
+	)).Methods("POST")
+
+	r.Handle("/uploads/{id}", negroni.New(
+		negroni.Wrap(http.HandlerFunc(uploadHandle.Options)),
+	)).Methods("OPTIONS")
+
+	r.Handle("/uploads/{id}", negroni.New(
+		negroni.HandlerFunc(resp.CORS),
+		negroni.HandlerFunc(j.Require(auth.Authenticated)),
+		negroni.Wrap(http.HandlerFunc(uploadHandle.Head)),
+	)).Methods("HEAD")
+
+	r.Handle("/uploads/{id}", negroni.New(
+		negroni.HandlerFunc(resp.CORS),
+		negroni.HandlerFunc(j.Require(auth.Authenticated)),
+		negroni.Wrap(http.HandlerFunc(uploadHandle.Patch)),
+	)).Methods("PATCH")
+
+	r.Handle("/uploads/{id}", negroni.New(
+		negroni.HandlerFunc(resp.CORS),
+		negroni.HandlerFunc(j.Require(auth.Authenticated)),
+		negroni.Wrap(http.HandlerFunc(uploadHandle.Delete)),
+	)).Methods("DELETE")
+
+	r.Handle("/videos/{id}/progress", negroni.New(
+		negroni.HandlerFunc(resp.CORS),
+		negroni.HandlerFunc(j.Require(auth.Authenticated)),
+		negroni.Wrap(http.HandlerFunc(videoHandle.ReportProgress)),
+	)).Methods("POST", "OPTIONS")
+
+	r.Handle("/me/courses/", negroni.New(
+		negroni.HandlerFunc(resp.CORS),
+		negroni.HandlerFunc(j.Require(auth.Authenticated)),
+		negroni.Wrap(http.HandlerFunc(enrollmentHandle.Mine)),
+	)).Methods("GET", "OPTIONS")
+
+	r.Handle("/categories/", negroni.New(
+		negroni.HandlerFunc(resp.CORS),
+		negroni.HandlerFunc(j.Require(auth.Anonymous)),
+		negroni.Wrap(http.HandlerFunc(categoryHandle.All)),
+	)).Methods("GET", "OPTIONS")
+
+	r.Handle("/categories/", negroni.New(
+		negroni.HandlerFunc(resp.CORS),
+		negroni.HandlerFunc(j.Require(auth.Admin)),
+		negroni.Wrap(http.HandlerFunc(categoryHandle.Create)),
+	)).Methods("POST", "OPTIONS")
+
+	r.Handle("/categories/{id}", negroni.New(
+		negroni.HandlerFunc(resp.CORS),
+		negroni.HandlerFunc(j.Require(auth.Admin)),
+		negroni.Wrap(http.HandlerFunc(categoryHandle.Update)),
+	)).Methods("PUT", "OPTIONS")
+
+	r.Handle("/categories/{id}", negroni.New(
+		negroni.HandlerFunc(resp.CORS),
+		negroni.HandlerFunc(j.Require(auth.Admin)),
+		negroni.Wrap(http.HandlerFunc(categoryHandle.Delete)),
+	)).Methods("DELETE", "OPTIONS")
+
+	r.Handle("/tags/", negroni.New(
+		negroni.HandlerFunc(resp.CORS),
+		negroni.HandlerFunc(j.Require(auth.Anonymous)),
+		negroni.Wrap(http.HandlerFunc(tagHandle.All)),
+	)).Methods("GET", "OPTIONS")
+
+	r.Handle("/tags/", negroni.New(
+		negroni.HandlerFunc(resp.CORS),
+		negroni.HandlerFunc(j.Require(auth.Admin)),
+		negroni.Wrap(http.HandlerFunc(tagHandle.Create)),
+	)).Methods("POST", "OPTIONS")
+
+	r.Handle("/tags/{id}", negroni.New(
+		negroni.HandlerFunc(resp.CORS),
+		negroni.HandlerFunc(j.Require(auth.Admin)),
+		negroni.Wrap(http.HandlerFunc(tagHandle.Update)),
+	)).Methods("PUT", "OPTIONS")
+
+	r.Handle("/tags/{id}", negroni.New(
+		negroni.HandlerFunc(resp.CORS),
+		negroni.HandlerFunc(j.Require(auth.Admin)),
+		negroni.Wrap(http.HandlerFunc(tagHandle.Delete)),
+	)).Methods("DELETE", "OPTIONS")
+
+	r.Handle("/paths/", negroni.New(
+		negroni.HandlerFunc(resp.CORS),
+		negroni.HandlerFunc(j.Require(auth.Anonymous)),
+		negroni.Wrap(http.HandlerFunc(pathHandle.All)),
+	)).Methods("GET", "OPTIONS")
+
+	r.Handle("/paths/", negroni.New(
+		negroni.HandlerFunc(resp.CORS),
+		negroni.HandlerFunc(j.Require(auth.Admin)),
+		negroni.Wrap(http.HandlerFunc(pathHandle.Create)),
+	)).Methods("POST", "OPTIONS")
+
+	r.Handle("/paths/{id}", negroni.New(
+		negroni.HandlerFunc(resp.CORS),
+		negroni.HandlerFunc(j.Require(auth.Anonymous)),
+		negroni.Wrap(http.HandlerFunc(pathHandle.Get)),
+	)).Methods("GET", "OPTIONS")
+
+	r.Handle("/paths/{id}", negroni.New(
+		negroni.HandlerFunc(resp.CORS),
+		negroni.HandlerFunc(j.Require(auth.Admin)),
+		negroni.Wrap(http.HandlerFunc(pathHandle.Update)),
+	)).Methods("PUT", "OPTIONS")
+
+	r.Handle("/paths/{id}", negroni.New(
+		negroni.HandlerFunc(resp.CORS),
+		negroni.HandlerFunc(j.Require(auth.Admin)),
+		negroni.Wrap(http.HandlerFunc(pathHandle.Delete)),
+	)).Methods("DELETE", "OPTIONS")
+
+	r.Handle("/paths/{id}/enrollment", negroni.New(
+		negroni.HandlerFunc(resp.CORS),
+		negroni.HandlerFunc(j.Require(auth.Authenticated)),
+		negroni.Wrap(http.HandlerFunc(pathHandle.Enroll)),
+	)).Methods("POST", "OPTIONS")
+
+	r.Handle("/paths/{id}/progress", negroni.New(
+		negroni.HandlerFunc(resp.CORS),
+		negroni.HandlerFunc(j.Require(auth.Authenticated)),
+		negroni.Wrap(http.HandlerFunc(pathHandle.Progress)),
+	)).Methods("GET", "OPTIONS")
+
 	r.Handle("/videos/", negroni.New(
 
 		negroni.HandlerFunc(resp.CORS),
+		negroni.HandlerFunc(j.Require(auth.Anonymous)),
 
 		negroni.Wrap(http.HandlerFunc(videoHandle.All)),
 	)).Methods("GET", "OPTIONS")
@@ -151,6 +724,7 @@ func main() {
 	r.Handle("/videos/{id}", negroni.New(
 
 		negroni.HandlerFunc(resp.CORS),
+		negroni.HandlerFunc(j.Require(auth.Anonymous)),
 
 		negroni.Wrap(http.HandlerFunc(videoHandle.Get)),
 	)).Methods("GET", "OPTIONS")
@@ -158,6 +732,7 @@ func main() {
 	r.Handle("/videos/{id}", negroni.New(
 
 		negroni.HandlerFunc(resp.CORS),
+		negroni.HandlerFunc(j.Require(auth.Authenticated)),
 
 		negroni.Wrap(http.HandlerFunc(videoHandle.Update)),
 	)).Methods("PUT", "OPTIONS")
@@ -165,6 +740,7 @@ func main() {
 	r.Handle("/videos/{id}", negroni.New(
 
 		negroni.HandlerFunc(resp.CORS),
+		negroni.HandlerFunc(j.Require(auth.Authenticated)),
 
 		negroni.Wrap(http.HandlerFunc(videoHandle.Delete)),
 	)).Methods("DELETE", "OPTIONS")
@@ -172,6 +748,7 @@ func main() {
 	r.Handle("/videos/", negroni.New(
 
 		negroni.HandlerFunc(resp.CORS),
+		negroni.HandlerFunc(j.Require(auth.Authenticated)),
 
 		negroni.Wrap(http.HandlerFunc(videoHandle.Create)),
 	)).Methods("POST", "OPTIONS")
@@ -179,6 +756,7 @@ func main() {
 	r.Handle("/videos/{id}/cover", negroni.New(
 
 		negroni.HandlerFunc(resp.CORS),
+		negroni.HandlerFunc(j.Require(auth.Authenticated)),
 
 		negroni.Wrap(http.HandlerFunc(videoHandle.CreateCover)),
 	)).Methods("POST", "OPTIONS")
@@ -186,6 +764,7 @@ func main() {
 	r.Handle("/videos/{id}/cover", negroni.New(
 
 		negroni.HandlerFunc(resp.CORS),
+		negroni.HandlerFunc(j.Require(auth.Authenticated)),
 
 		negroni.Wrap(http.HandlerFunc(videoHandle.UpdateCover)),
 	)).Methods("PUT", "OPTIONS")
@@ -193,6 +772,7 @@ func main() {
 	r.Handle("/videos/{id}/src", negroni.New(
 
 		negroni.HandlerFunc(resp.CORS),
+		negroni.HandlerFunc(j.Require(auth.Authenticated)),
 
 		negroni.Wrap(http.HandlerFunc(videoHandle.CreateSrc)),
 	)).Methods("POST", "OPTIONS")
@@ -200,41 +780,116 @@ func main() {
 	r.Handle("/videos/{id}/src", negroni.New(
 
 		negroni.HandlerFunc(resp.CORS),
+		negroni.HandlerFunc(j.Require(auth.Authenticated)),
 
 		negroni.Wrap(http.HandlerFunc(videoHandle.UpdateSrc)),
 	)).Methods("PUT", "OPTIONS")
 
 	r.Handle("/users/", negroni.New(
 		negroni.HandlerFunc(resp.CORS),
+		negroni.HandlerFunc(j.Require(auth.Admin)),
 		negroni.Wrap(http.HandlerFunc(usersHandle.All)),
 	)).Methods("GET", "OPTIONS")
 
 	r.Handle("/users/", negroni.New(
 		negroni.HandlerFunc(resp.CORS),
+		negroni.HandlerFunc(j.Require(auth.Admin)),
 		negroni.Wrap(http.HandlerFunc(usersHandle.Create)),
 	)).Methods("POST", "OPTIONS")
 
 	r.Handle("/users/{id}", negroni.New(
 		negroni.HandlerFunc(resp.CORS),
+		negroni.HandlerFunc(j.Require(auth.Admin)),
 		negroni.Wrap(http.HandlerFunc(usersHandle.Get)),
 	)).Methods("GET", "OPTIONS")
 
 	r.Handle("/users/{id}", negroni.New(
 		negroni.HandlerFunc(resp.CORS),
+		negroni.HandlerFunc(j.Require(auth.Admin)),
 		negroni.Wrap(http.HandlerFunc(usersHandle.Update)),
 	)).Methods("PUT", "OPTIONS")
 
 	r.Handle("/users/{id}", negroni.New(
 
 		negroni.HandlerFunc(resp.CORS),
+		negroni.HandlerFunc(j.Require(auth.Admin)),
 
 		negroni.Wrap(http.HandlerFunc(usersHandle.Delete)),
 	)).Methods("DELETE", "OPTIONS")
 
-	r.PathPrefix("/static/").
-		Handler(http.StripPrefix("/static/", http.FileServer(http.Dir("./static/"))))
+	r.Handle("/users/{id}/restore", negroni.New(
+		negroni.HandlerFunc(resp.CORS),
+		negroni.HandlerFunc(j.Require(auth.Admin)),
+		negroni.Wrap(http.HandlerFunc(usersHandle.Restore)),
+	)).Methods("POST", "OPTIONS")
+
+	r.Handle("/trash/courses/", negroni.New(
+		negroni.HandlerFunc(resp.CORS),
+		negroni.HandlerFunc(j.Require(auth.Admin)),
+		negroni.Wrap(http.HandlerFunc(courseHandle.Trash)),
+	)).Methods("GET", "OPTIONS")
+
+	r.Handle("/trash/videos/", negroni.New(
+		negroni.HandlerFunc(resp.CORS),
+		negroni.HandlerFunc(j.Require(auth.Admin)),
+		negroni.Wrap(http.HandlerFunc(videoHandle.Trash)),
+	)).Methods("GET", "OPTIONS")
+
+	r.Handle("/trash/users/", negroni.New(
+		negroni.HandlerFunc(resp.CORS),
+		negroni.HandlerFunc(j.Require(auth.Admin)),
+		negroni.Wrap(http.HandlerFunc(usersHandle.Trash)),
+	)).Methods("GET", "OPTIONS")
+
+	r.Handle("/users/{id}/unlock", negroni.New(
+		negroni.HandlerFunc(resp.CORS),
+		negroni.HandlerFunc(j.Require(auth.Admin)),
+		negroni.Wrap(http.HandlerFunc(usersHandle.Unlock)),
+	)).Methods("POST", "OPTIONS")
+
+	r.Handle("/auth/keys/", negroni.New(
+		negroni.HandlerFunc(resp.CORS),
+		negroni.HandlerFunc(j.Require(auth.Authenticated)),
+		negroni.Wrap(http.HandlerFunc(apiKeyHandle.All)),
+	)).Methods("GET", "OPTIONS")
+
+	r.Handle("/auth/keys/", negroni.New(
+		negroni.HandlerFunc(resp.CORS),
+		negroni.HandlerFunc(j.Require(auth.Authenticated)),
+		negroni.Wrap(http.HandlerFunc(apiKeyHandle.Create)),
+	)).Methods("POST", "OPTIONS")
+
+	r.Handle("/auth/keys/{id}", negroni.New(
+		negroni.HandlerFunc(resp.CORS),
+		negroni.HandlerFunc(j.Require(auth.Authenticated)),
+		negroni.Wrap(http.HandlerFunc(apiKeyHandle.Delete)),
+	)).Methods("DELETE", "OPTIONS")
+
+	r.Handle("/auth/sessions/", negroni.New(
+		negroni.HandlerFunc(resp.CORS),
+		negroni.HandlerFunc(j.Require(auth.Authenticated)),
+		negroni.Wrap(http.HandlerFunc(sessionHandle.All)),
+	)).Methods("GET", "OPTIONS")
+
+	r.Handle("/auth/sessions/{id}", negroni.New(
+		negroni.HandlerFunc(resp.CORS),
+		negroni.HandlerFunc(j.Require(auth.Authenticated)),
+		negroni.Wrap(http.HandlerFunc(sessionHandle.Delete)),
+	)).Methods("DELETE", "OPTIONS")
+
+	r.Handle("/users/{id}/sessions", negroni.New(
+		negroni.HandlerFunc(resp.CORS),
+		negroni.HandlerFunc(j.Require(auth.Admin)),
+		negroni.Wrap(http.HandlerFunc(usersHandle.RevokeSessions)),
+	)).Methods("DELETE", "OPTIONS")
+
+	router.PathPrefix("/static/").Handler(negroni.New(
+		negroni.HandlerFunc(resp.CORS),
+		negroni.HandlerFunc(j.Require(auth.Anonymous)),
+		negroni.Wrap(http.HandlerFunc(mediaHandle.Serve)),
+	)).Methods("GET", "HEAD", "OPTIONS")
 
-	http.Handle("/", r)
+	http.Handle("/", router)
 
 	http.ListenAndServe(":9001", nil)
 }
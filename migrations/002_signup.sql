@@ -0,0 +1,16 @@
+ALTER TABLE `user` ADD COLUMN `email_verified_at` datetime DEFAULT NULL;
+UPDATE `user` SET `email_verified_at` = `created_at`;
+
+CREATE TABLE `user_token` (
+  `id` int(11) NOT NULL AUTO_INCREMENT,
+  `user_id` int(11) NOT NULL,
+  `purpose` varchar(32) NOT NULL,
+  `token_hash` char(64) NOT NULL,
+  `expires_at` datetime NOT NULL,
+  `used_at` datetime DEFAULT NULL,
+  `created_at` datetime NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  PRIMARY KEY (`id`),
+  UNIQUE KEY `user_token_hash` (`token_hash`),
+  KEY `user_token_user` (`user_id`, `purpose`),
+  CONSTRAINT `user_token_user_fk` FOREIGN KEY (`user_id`) REFERENCES `user` (`id`) ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8;
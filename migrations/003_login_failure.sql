@@ -0,0 +1,8 @@
+CREATE TABLE `login_failure` (
+  `scope` varchar(16) NOT NULL,
+  `key` varchar(255) NOT NULL,
+  `failures` int(11) NOT NULL DEFAULT 0,
+  `last_failed_at` datetime NOT NULL,
+  `locked_until` datetime DEFAULT NULL,
+  PRIMARY KEY (`scope`, `key`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8;
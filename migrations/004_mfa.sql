@@ -0,0 +1,15 @@
+ALTER TABLE `user`
+  ADD COLUMN `mfa_secret` varchar(64) DEFAULT NULL,
+  ADD COLUMN `mfa_enabled_at` datetime DEFAULT NULL,
+  ADD COLUMN `mfa_last_step` bigint(20) NOT NULL DEFAULT 0;
+
+CREATE TABLE `mfa_recovery_code` (
+  `id` int(11) NOT NULL AUTO_INCREMENT,
+  `user_id` int(11) NOT NULL,
+  `code_hash` char(64) NOT NULL,
+  `used_at` datetime DEFAULT NULL,
+  `created_at` datetime NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  PRIMARY KEY (`id`),
+  KEY `mfa_recovery_code_user` (`user_id`),
+  CONSTRAINT `mfa_recovery_code_user_fk` FOREIGN KEY (`user_id`) REFERENCES `user` (`id`) ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8;
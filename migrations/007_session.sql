@@ -0,0 +1,20 @@
+CREATE TABLE `session` (
+  `id` varchar(64) NOT NULL,
+  `user_id` int(11) NOT NULL,
+  `user_agent` varchar(255) NOT NULL DEFAULT '',
+  `ip` varchar(45) NOT NULL DEFAULT '',
+  `created_at` datetime NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  `last_seen_at` datetime NOT NULL,
+  `expires_at` datetime NOT NULL,
+  `revoked_at` datetime DEFAULT NULL,
+  PRIMARY KEY (`id`),
+  KEY `session_user` (`user_id`),
+  CONSTRAINT `session_user_fk` FOREIGN KEY (`user_id`) REFERENCES `user` (`id`) ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8;
+
+-- refresh tokens issued before sessions existed can't be tied to one
+DELETE FROM `refresh_token`;
+ALTER TABLE `refresh_token`
+  ADD COLUMN `session_id` varchar(64) NOT NULL AFTER `user_id`,
+  ADD KEY `refresh_token_session` (`session_id`),
+  ADD CONSTRAINT `refresh_token_session_fk` FOREIGN KEY (`session_id`) REFERENCES `session` (`id`) ON DELETE CASCADE;
@@ -0,0 +1,15 @@
+ALTER TABLE `video` ADD COLUMN `duration` int(11) DEFAULT NULL;
+
+CREATE TABLE `video_progress` (
+  `user_id` int(11) NOT NULL,
+  `video_id` int(11) NOT NULL,
+  `position` int(11) NOT NULL DEFAULT 0,
+  `furthest_position` int(11) NOT NULL DEFAULT 0,
+  `watched_seconds` int(11) NOT NULL DEFAULT 0,
+  `completed_at` datetime DEFAULT NULL,
+  `updated_at` datetime NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+  PRIMARY KEY (`user_id`, `video_id`),
+  KEY `video_progress_video` (`video_id`),
+  CONSTRAINT `video_progress_user_fk` FOREIGN KEY (`user_id`) REFERENCES `user` (`id`) ON DELETE CASCADE,
+  CONSTRAINT `video_progress_video_fk` FOREIGN KEY (`video_id`) REFERENCES `video` (`id`) ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8;
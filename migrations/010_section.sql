@@ -0,0 +1,23 @@
+CREATE TABLE `section` (
+  `id` int(11) NOT NULL AUTO_INCREMENT,
+  `course_id` int(11) NOT NULL,
+  `name` varchar(255) NOT NULL,
+  `description` text,
+  `position` int(11) NOT NULL DEFAULT 0,
+  `created_at` datetime NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  `updated_at` datetime NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+  PRIMARY KEY (`id`),
+  KEY `section_course_position` (`course_id`, `position`),
+  CONSTRAINT `section_course_fk` FOREIGN KEY (`course_id`) REFERENCES `course` (`id`) ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8;
+
+ALTER TABLE `video`
+  ADD COLUMN `section_id` int(11) DEFAULT NULL AFTER `course_id`,
+  ADD COLUMN `position` int(11) NOT NULL DEFAULT 0 AFTER `section_id`,
+  ADD KEY `video_course_position` (`course_id`, `section_id`, `position`),
+  ADD CONSTRAINT `video_section_fk` FOREIGN KEY (`section_id`) REFERENCES `section` (`id`) ON DELETE SET NULL;
+
+-- existing videos keep their upload order
+UPDATE `video` v
+  JOIN (SELECT id, (SELECT COUNT(*) FROM `video` p WHERE p.course_id = o.course_id AND (p.created_at < o.created_at OR (p.created_at = o.created_at AND p.id < o.id))) AS pos FROM `video` o) ordered ON ordered.id = v.id
+  SET v.position = ordered.pos;
@@ -0,0 +1,13 @@
+ALTER TABLE `course`
+  ADD COLUMN `status` varchar(16) NOT NULL DEFAULT 'draft',
+  ADD COLUMN `publish_at` datetime DEFAULT NULL,
+  ADD KEY `course_status_publish_at` (`status`, `publish_at`);
+
+ALTER TABLE `video`
+  ADD COLUMN `status` varchar(16) NOT NULL DEFAULT 'draft',
+  ADD COLUMN `publish_at` datetime DEFAULT NULL,
+  ADD KEY `video_status_publish_at` (`status`, `publish_at`);
+
+-- everything that was visible before stays visible
+UPDATE `course` SET `status` = 'published', `publish_at` = `created_at`;
+UPDATE `video` SET `status` = 'published', `publish_at` = `created_at`;
@@ -0,0 +1,11 @@
+ALTER TABLE `course`
+  ADD COLUMN `deleted_at` datetime DEFAULT NULL,
+  ADD KEY `course_deleted_at` (`deleted_at`);
+
+ALTER TABLE `video`
+  ADD COLUMN `deleted_at` datetime DEFAULT NULL,
+  ADD KEY `video_deleted_at` (`deleted_at`);
+
+ALTER TABLE `user`
+  ADD COLUMN `deleted_at` datetime DEFAULT NULL,
+  ADD KEY `user_deleted_at` (`deleted_at`);
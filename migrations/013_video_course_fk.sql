@@ -0,0 +1,7 @@
+-- videos of courses that were hard deleted before soft delete existed
+-- can't be reached anymore and would block the constraint
+DELETE FROM `video` WHERE `course_id` NOT IN (SELECT `id` FROM `course`);
+
+-- courses are only removed by the purge job, which removes their videos first
+ALTER TABLE `video`
+  ADD CONSTRAINT `video_course_fk` FOREIGN KEY (`course_id`) REFERENCES `course` (`id`) ON DELETE RESTRICT;
@@ -0,0 +1,13 @@
+ALTER TABLE `user`
+  ADD COLUMN `is_instructor` tinyint(1) NOT NULL DEFAULT 0 AFTER `is_admin`;
+
+CREATE TABLE `course_instructor` (
+  `course_id` int(11) NOT NULL,
+  `user_id` int(11) NOT NULL,
+  `role` varchar(16) NOT NULL,
+  `created_at` datetime NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  PRIMARY KEY (`course_id`, `user_id`),
+  KEY `course_instructor_user` (`user_id`),
+  CONSTRAINT `course_instructor_course_fk` FOREIGN KEY (`course_id`) REFERENCES `course` (`id`) ON DELETE CASCADE,
+  CONSTRAINT `course_instructor_user_fk` FOREIGN KEY (`user_id`) REFERENCES `user` (`id`) ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8;
@@ -0,0 +1,9 @@
+CREATE TABLE `course_prerequisite` (
+  `course_id` int(11) NOT NULL,
+  `prerequisite_id` int(11) NOT NULL,
+  `created_at` datetime NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  PRIMARY KEY (`course_id`, `prerequisite_id`),
+  KEY `course_prerequisite_prerequisite` (`prerequisite_id`),
+  CONSTRAINT `course_prerequisite_course_fk` FOREIGN KEY (`course_id`) REFERENCES `course` (`id`) ON DELETE CASCADE,
+  CONSTRAINT `course_prerequisite_prerequisite_fk` FOREIGN KEY (`prerequisite_id`) REFERENCES `course` (`id`) ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8;
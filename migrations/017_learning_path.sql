@@ -0,0 +1,28 @@
+CREATE TABLE `learning_path` (
+  `id` int(11) NOT NULL AUTO_INCREMENT,
+  `name` varchar(255) NOT NULL,
+  `description` text,
+  `created_at` datetime NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  `updated_at` datetime NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+  PRIMARY KEY (`id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8;
+
+CREATE TABLE `learning_path_course` (
+  `path_id` int(11) NOT NULL,
+  `course_id` int(11) NOT NULL,
+  `position` int(11) NOT NULL,
+  PRIMARY KEY (`path_id`, `course_id`),
+  KEY `learning_path_course_course` (`course_id`),
+  CONSTRAINT `learning_path_course_path_fk` FOREIGN KEY (`path_id`) REFERENCES `learning_path` (`id`) ON DELETE CASCADE,
+  CONSTRAINT `learning_path_course_course_fk` FOREIGN KEY (`course_id`) REFERENCES `course` (`id`) ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8;
+
+CREATE TABLE `learning_path_enrollment` (
+  `user_id` int(11) NOT NULL,
+  `path_id` int(11) NOT NULL,
+  `enrolled_at` datetime NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  PRIMARY KEY (`user_id`, `path_id`),
+  KEY `learning_path_enrollment_path` (`path_id`),
+  CONSTRAINT `learning_path_enrollment_user_fk` FOREIGN KEY (`user_id`) REFERENCES `user` (`id`) ON DELETE CASCADE,
+  CONSTRAINT `learning_path_enrollment_path_fk` FOREIGN KEY (`path_id`) REFERENCES `learning_path` (`id`) ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8;
@@ -0,0 +1,16 @@
+ALTER TABLE `video`
+  ADD COLUMN `public` tinyint(1) NOT NULL DEFAULT 0 AFTER `offline`;
+
+CREATE TABLE `video_view` (
+  `id` int(11) NOT NULL AUTO_INCREMENT,
+  `video_id` int(11) NOT NULL,
+  `user_id` int(11) DEFAULT NULL,
+  `ip` varchar(45) NOT NULL,
+  `user_agent` varchar(255) NOT NULL DEFAULT '',
+  `created_at` datetime NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  PRIMARY KEY (`id`),
+  KEY `video_view_video` (`video_id`, `created_at`),
+  KEY `video_view_user` (`user_id`),
+  CONSTRAINT `video_view_video_fk` FOREIGN KEY (`video_id`) REFERENCES `video` (`id`) ON DELETE CASCADE,
+  CONSTRAINT `video_view_user_fk` FOREIGN KEY (`user_id`) REFERENCES `user` (`id`) ON DELETE SET NULL
+) ENGINE=InnoDB DEFAULT CHARSET=utf8;
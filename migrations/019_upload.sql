@@ -0,0 +1,14 @@
+CREATE TABLE `upload` (
+  `id` char(32) NOT NULL,
+  `video_id` int(11) NOT NULL,
+  `user_id` int(11) NOT NULL,
+  `length` bigint(20) NOT NULL,
+  `offset` bigint(20) NOT NULL DEFAULT 0,
+  `extension` varchar(8) NOT NULL,
+  `expires_at` datetime NOT NULL,
+  `created_at` datetime NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  PRIMARY KEY (`id`),
+  KEY `upload_expires_at` (`expires_at`),
+  CONSTRAINT `upload_video_fk` FOREIGN KEY (`video_id`) REFERENCES `video` (`id`) ON DELETE CASCADE,
+  CONSTRAINT `upload_user_fk` FOREIGN KEY (`user_id`) REFERENCES `user` (`id`) ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8;
@@ -0,0 +1,3 @@
+ALTER TABLE `oidc_login`
+  ADD COLUMN `user_id` int(11) DEFAULT NULL AFTER `code_verifier`,
+  ADD CONSTRAINT `oidc_login_user_fk` FOREIGN KEY (`user_id`) REFERENCES `user` (`id`) ON DELETE CASCADE;
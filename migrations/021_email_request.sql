@@ -0,0 +1,7 @@
+CREATE TABLE `email_request` (
+  `scope` varchar(16) NOT NULL,
+  `key` varchar(255) NOT NULL,
+  `requests` int(11) NOT NULL DEFAULT 0,
+  `window_started_at` datetime NOT NULL,
+  PRIMARY KEY (`scope`, `key`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8;
@@ -0,0 +1 @@
+ALTER TABLE `user` ADD UNIQUE KEY `user_email` (`email`);
@@ -0,0 +1,137 @@
+package model
+
+import (
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/arizanovj/courses/auth"
+	"github.com/arizanovj/courses/env"
+	"github.com/go-ozzo/ozzo-validation"
+)
+
+const apiKeyPrefix = "ck_"
+
+var (
+	ErrInvalidAPIKey  = errors.New("invalid, revoked or expired API key")
+	ErrAPIKeyNotFound = errors.New("there is no such API key")
+)
+
+type APIKey struct {
+	ID         int64      `json:"id"`
+	UserID     int64      `json:"user_id"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`
+	Scopes     []string   `json:"scopes"`
+	ExpiresAt  *time.Time `json:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	RevokedAt  *time.Time `json:"revoked_at"`
+	CreatedAt  string     `json:"created_at"`
+	Key        string     `json:"key,omitempty"`
+	Env        *env.Env   `json:"-"`
+}
+
+func (k APIKey) Validate() error {
+	return validation.ValidateStruct(&k,
+		validation.Field(&k.Name, validation.Required, validation.Length(1, 100)),
+		validation.Field(&k.Scopes, validation.Required, validation.Each(validation.In(auth.ScopeRead, auth.ScopeWrite))),
+		validation.Field(&k.ExpiresAt, validation.Min(time.Now())),
+	)
+}
+
+// Create stores the hash of a new key. The key itself is only set on the
+// returned struct and can't be recovered later.
+func (k *APIKey) Create() (*APIKey, error) {
+	token, err := auth.NewToken()
+	if err != nil {
+		return nil, err
+	}
+	key := apiKeyPrefix + token
+	k.Prefix = key[:len(apiKeyPrefix)+8]
+
+	result, err := k.Env.DB.Exec("INSERT INTO api_key (`user_id`,`name`,`prefix`,`key_hash`,`scopes`,`expires_at`) VALUES (?,?,?,?,?,?) ",
+		&k.UserID, &k.Name, &k.Prefix, auth.HashToken(key), strings.Join(k.Scopes, ","), k.ExpiresAt)
+	if err != nil {
+		return nil, err
+	}
+	k.ID, err = result.LastInsertId()
+	if err != nil {
+		return nil, err
+	}
+	k.Key = key
+	return k, nil
+}
+
+func (k *APIKey) GetForUser(userID int64) ([]*APIKey, error) {
+	keys := []*APIKey{}
+	rows, err := k.Env.DB.Query("SELECT id, user_id, name, prefix, scopes, expires_at, last_used_at, revoked_at, created_at FROM api_key WHERE user_id = ? ORDER BY created_at DESC", userID)
+	if err != nil {
+		return keys, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		key := new(APIKey)
+		var scopes string
+		if err := rows.Scan(&key.ID, &key.UserID, &key.Name, &key.Prefix, &scopes, &key.ExpiresAt, &key.LastUsedAt, &key.RevokedAt, &key.CreatedAt); err != nil {
+			return keys, err
+		}
+		key.Scopes = strings.Split(scopes, ",")
+		keys = append(keys, key)
+	}
+	return keys, rows.Err()
+}
+
+func (k *APIKey) Revoke(userID int64, ID int64) error {
+	result, err := k.Env.DB.Exec("UPDATE api_key SET revoked_at = NOW() WHERE id = ? AND user_id = ? AND revoked_at IS NULL", ID, userID)
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrAPIKeyNotFound
+	}
+	return nil
+}
+
+// APIKeyStore lets the auth middleware accept API keys.
+type APIKeyStore struct {
+	Env *env.Env
+}
+
+func (s *APIKeyStore) AuthenticateAPIKey(key string) (*auth.Identity, error) {
+	var (
+		id        int64
+		scopes    string
+		expiresAt *time.Time
+		revokedAt *time.Time
+		lastUsed  *time.Time
+		isAdmin   bool
+	)
+	identity := &auth.Identity{}
+	err := s.Env.DB.QueryRow("SELECT k.id, k.scopes, k.expires_at, k.revoked_at, k.last_used_at, u.id, u.email, u.is_admin FROM api_key k JOIN `user` u ON u.id = k.user_id WHERE k.key_hash = ? AND u.deleted_at IS NULL", auth.HashToken(key)).
+		Scan(&id, &scopes, &expiresAt, &revokedAt, &lastUsed, &identity.ID, &identity.Email, &isAdmin)
+	if err == sql.ErrNoRows {
+		return nil, ErrInvalidAPIKey
+	} else if err != nil {
+		return nil, err
+	}
+	if revokedAt != nil || (expiresAt != nil && expiresAt.Before(time.Now())) {
+		return nil, ErrInvalidAPIKey
+	}
+
+	// last use is only tracked to the minute to spare a write per request
+	if lastUsed == nil || time.Since(*lastUsed) > time.Minute {
+		if _, err := s.Env.DB.Exec("UPDATE api_key SET last_used_at = NOW() WHERE id = ?", id); err != nil {
+			return nil, err
+		}
+	}
+
+	identity.IsAdmin = isAdmin
+	identity.APIKeyID = id
+	identity.Scopes = strings.Split(scopes, ",")
+	return identity, nil
+}
@@ -0,0 +1,152 @@
+package model
+
+import (
+	"database/sql"
+	"errors"
+
+	"github.com/arizanovj/courses/env"
+	"github.com/go-ozzo/ozzo-validation"
+)
+
+var (
+	ErrCategoryNotFound    = errors.New("there is no such category")
+	ErrCategoryCycle       = errors.New("a category can't be moved below itself")
+	ErrCategoryHasChildren = errors.New("category still has subcategories")
+)
+
+type Category struct {
+	ID        int64       `json:"id"`
+	ParentID  *int64      `json:"parent_id"`
+	Name      string      `json:"name"`
+	CreatedAt string      `json:"created_at"`
+	UpdatedAt string      `json:"updated_at"`
+	Children  []*Category `json:"children,omitempty"`
+	Env       *env.Env    `json:"-"`
+}
+
+func (c Category) Validate() error {
+	return validation.ValidateStruct(&c,
+		validation.Field(&c.Name, validation.Required, validation.Length(1, 100)),
+	)
+}
+
+func (c *Category) GetAll() ([]*Category, error) {
+	categories := []*Category{}
+	rows, err := c.Env.DB.Query("SELECT id, parent_id, name, created_at, updated_at FROM category ORDER BY name")
+	if err != nil {
+		return categories, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		category := &Category{Env: c.Env}
+		if err := rows.Scan(&category.ID, &category.ParentID, &category.Name, &category.CreatedAt, &category.UpdatedAt); err != nil {
+			return categories, err
+		}
+		categories = append(categories, category)
+	}
+	return categories, rows.Err()
+}
+
+// Tree returns the root categories with their subcategories nested.
+func (c *Category) Tree() ([]*Category, error) {
+	categories, err := c.GetAll()
+	if err != nil {
+		return nil, err
+	}
+	byID := make(map[int64]*Category, len(categories))
+	for _, category := range categories {
+		byID[category.ID] = category
+	}
+	roots := []*Category{}
+	for _, category := range categories {
+		if category.ParentID != nil && byID[*category.ParentID] != nil {
+			parent := byID[*category.ParentID]
+			parent.Children = append(parent.Children, category)
+		} else {
+			roots = append(roots, category)
+		}
+	}
+	return roots, nil
+}
+
+func (c *Category) GetByID(ID int64) (*Category, error) {
+	err := c.Env.DB.QueryRow("SELECT id, parent_id, name, created_at, updated_at FROM category WHERE id = ?", ID).
+		Scan(&c.ID, &c.ParentID, &c.Name, &c.CreatedAt, &c.UpdatedAt)
+	if err == sql.ErrNoRows {
+		return &Category{}, ErrCategoryNotFound
+	} else if err != nil {
+		return &Category{}, err
+	}
+	return c, nil
+}
+
+func (c *Category) Create() (int64, error) {
+	if err := c.checkParent(); err != nil {
+		return 0, err
+	}
+	result, err := c.Env.DB.Exec("INSERT INTO category (`parent_id`,`name`) VALUES (?,?)", &c.ParentID, &c.Name)
+	if err != nil {
+		return 0, err
+	}
+	return result.LastInsertId()
+}
+
+func (c *Category) Update() error {
+	if _, err := (&Category{Env: c.Env}).GetByID(c.ID); err != nil {
+		return err
+	}
+	if err := c.checkParent(); err != nil {
+		return err
+	}
+	_, err := c.Env.DB.Exec("UPDATE category SET `parent_id` = ?, `name` = ? WHERE id = ?", &c.ParentID, &c.Name, &c.ID)
+	return err
+}
+
+// Delete removes a category without subcategories, its courses become
+// uncategorised.
+func (c *Category) Delete() error {
+	var children int
+	if err := c.Env.DB.QueryRow("SELECT COUNT(*) FROM category WHERE parent_id = ?", c.ID).Scan(&children); err != nil {
+		return err
+	}
+	if children > 0 {
+		return ErrCategoryHasChildren
+	}
+	result, err := c.Env.DB.Exec("DELETE FROM category WHERE id = ?", c.ID)
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrCategoryNotFound
+	}
+	return nil
+}
+
+// checkParent makes sure the parent exists and is not the category itself
+// or one of its descendants.
+func (c *Category) checkParent() error {
+	if c.ParentID == nil {
+		return nil
+	}
+	categories, err := c.GetAll()
+	if err != nil {
+		return err
+	}
+	parents := make(map[int64]*int64, len(categories))
+	for _, category := range categories {
+		parents[category.ID] = category.ParentID
+	}
+	if _, ok := parents[*c.ParentID]; !ok {
+		return ErrCategoryNotFound
+	}
+	for ID := c.ParentID; ID != nil; ID = parents[*ID] {
+		if c.ID != 0 && *ID == c.ID {
+			return ErrCategoryCycle
+		}
+	}
+	return nil
+}
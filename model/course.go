@@ -4,6 +4,7 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
+	"time"
 
 	"github.com/arizanovj/courses/env"
 	"github.com/arizanovj/courses/libs"
@@ -13,20 +14,75 @@ import (
 	_ "gopkg.in/doug-martin/goqu.v4/adapters/mysql"
 )
 
+var ErrCourseNotFound = errors.New("there is no such course")
+
+// DependentVideosError is returned when a course can't be deleted because
+// videos still belong to it.
+type DependentVideosError struct {
+	Videos []*Video
+}
+
+func (e *DependentVideosError) Error() string {
+	return fmt.Sprintf("course still has %d videos", len(e.Videos))
+}
+
 type Course struct {
 	ID          int64    `json:"id" filter:"id,number"`
 	Name        string   `json:"name" filter:"name,string"`
 	Description *string  `json:"description" filter:"description,string"`
 	Cover       *string  `json:"cover" filter:"-"`
-	CreatedAt   string   `json:"created_at"  filter:"created_at,date"`
-	UpdatedAt   string   `json:"updated_at"  filter:"updated_at,date"`
-	Env         *env.Env `json:"-"`
+	CategoryID  *int64   `json:"category_id" filter:"category_id,tree,category"`
+	Tags        []string `json:"tags" filter:"tag,tags,course_tag.course_id=course.id"`
+	// OwnerID becomes the owning instructor when the course is created.
+	OwnerID   *int64     `json:"owner_id,omitempty" filter:"-"`
+	Status    string     `json:"status" filter:"status,string"`
+	PublishAt *time.Time `json:"publish_at" filter:"publish_at,date"`
+	CreatedAt string     `json:"created_at"  filter:"created_at,date"`
+	UpdatedAt string     `json:"updated_at"  filter:"updated_at,date"`
+	DeletedAt *time.Time `json:"deleted_at,omitempty" filter:"deleted_at,date"`
+	Syllabus  *Syllabus  `json:"syllabus,omitempty" filter:"-"`
+	// OnlyPublished limits listings to what anonymous users may see.
+	OnlyPublished bool `json:"-"`
+	// Trash lists trashed courses instead of live ones.
+	Trash bool     `json:"-"`
+	Env   *env.Env `json:"-"`
+}
+
+// CourseFacets counts the courses matching a listing per category and tag.
+type CourseFacets struct {
+	Categories []*Facet `json:"categories"`
+	Tags       []*Facet `json:"tags"`
+}
+
+type Facet struct {
+	ID    *int64 `json:"id"`
+	Name  string `json:"name"`
+	Count int    `json:"count"`
+}
+
+// listing is the query every listing of courses starts from.
+func (course *Course) listing() *goqu.Dataset {
+	query := course.Env.QB.From(goqu.I("course")).Where(trashed(course.Trash)).Prepared(true)
+	if course.OnlyPublished {
+		query = query.Where(goqu.L(visibleSQL("")))
+	}
+	return query
 }
 
 func (course *Course) Get(p *pagination.Paginator, f *filter.Filter) ([]*Course, error) {
 	var courses []*Course
 
-	query := course.Env.QB.From(goqu.I("course")).Order(goqu.I("created_at").Desc()).Prepared(true)
+	query := course.listing().Select(
+		goqu.I("id"),
+		goqu.I("name"),
+		goqu.I("cover"),
+		goqu.I("description"),
+		goqu.I("category_id"),
+		goqu.I("status"),
+		goqu.I("publish_at"),
+		goqu.I("created_at"),
+		goqu.I("updated_at"),
+		goqu.I("deleted_at")).Order(goqu.I("created_at").Desc())
 
 	p.PK = "id"
 	query = f.Filterize(query)
@@ -38,13 +94,13 @@ func (course *Course) Get(p *pagination.Paginator, f *filter.Filter) ([]*Course,
 	defer rows.Close()
 	for rows.Next() {
 		c := new(Course)
-		if err := rows.Scan(&c.ID, &c.Name, &c.Cover, &c.Description, &c.CreatedAt, &c.UpdatedAt); err != nil {
+		if err := rows.Scan(&c.ID, &c.Name, &c.Cover, &c.Description, &c.CategoryID, &c.Status, &c.PublishAt, &c.CreatedAt, &c.UpdatedAt, &c.DeletedAt); err != nil {
 			fmt.Printf("%+v\n", err)
 		}
 		courses = append(courses, c)
 	}
 	if err == nil {
-		return courses, nil
+		return courses, course.loadTags(courses)
 	} else if err == sql.ErrNoRows {
 		return courses, errors.New("there aren't any courses")
 	}
@@ -52,17 +108,29 @@ func (course *Course) Get(p *pagination.Paginator, f *filter.Filter) ([]*Course,
 }
 func (course *Course) GetByID(ID int64) (*Course, error) {
 
-	err := course.Env.DB.QueryRow("SELECT id, name, description, cover, created_at,updated_at FROM course where id = ? ", ID).Scan(&course.ID, &course.Name, &course.Description, &course.Cover, &course.CreatedAt, &course.UpdatedAt)
+	err := course.Env.DB.QueryRow("SELECT id, name, description, cover, category_id, status, publish_at, created_at,updated_at FROM course where id = ? AND deleted_at IS NULL", ID).Scan(&course.ID, &course.Name, &course.Description, &course.Cover, &course.CategoryID, &course.Status, &course.PublishAt, &course.CreatedAt, &course.UpdatedAt)
 	if err != nil {
 		return &Course{}, err
 	}
+	if err := course.loadTags([]*Course{course}); err != nil {
+		return &Course{}, err
+	}
 	return course, nil
 
 }
 
 func (course *Course) Create() (int64, error) {
+	if err := course.checkCategory(); err != nil {
+		return 0, err
+	}
+
+	tx, err := course.Env.DB.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
 
-	result, err := course.Env.DB.Exec("INSERT INTO course (`name`,`description`) VALUES (?,? ) ", &course.Name, &course.Description)
+	result, err := tx.Exec("INSERT INTO course (`name`,`description`,`category_id`) VALUES (?,?,? ) ", &course.Name, &course.Description, &course.CategoryID)
 
 	if err != nil {
 		return 0, err
@@ -74,7 +142,18 @@ func (course *Course) Create() (int64, error) {
 		return 0, err
 	}
 
-	return lastID, nil
+	if err := setCourseTags(tx, lastID, course.Tags); err != nil {
+		return 0, err
+	}
+
+	if course.OwnerID != nil {
+		_, err = tx.Exec("INSERT INTO course_instructor (`course_id`,`user_id`,`role`) VALUES (?,?,?)", lastID, *course.OwnerID, InstructorOwner)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	return lastID, tx.Commit()
 }
 
 func (course *Course) UpdateCover() error {
@@ -87,20 +166,227 @@ func (course *Course) UpdateCover() error {
 	return err
 }
 
+// Update replaces the tags of the course only when Tags is set.
 func (course *Course) Update() error {
-	sql, err := course.Env.DB.Prepare("UPDATE course SET `name` = ?, `description` = ?  WHERE id=?")
+	if err := course.checkCategory(); err != nil {
+		return err
+	}
+
+	tx, err := course.Env.DB.Begin()
 	if err != nil {
 		return err
 	}
-	_, err = sql.Exec(&course.Name, &course.Description, &course.ID)
+	defer tx.Rollback()
 
+	_, err = tx.Exec("UPDATE course SET `name` = ?, `description` = ?, `category_id` = ?  WHERE id=?", &course.Name, &course.Description, &course.CategoryID, &course.ID)
+	if err != nil {
+		return err
+	}
+
+	if course.Tags != nil {
+		if err := setCourseTags(tx, course.ID, course.Tags); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+func (course *Course) checkCategory() error {
+	if course.CategoryID == nil {
+		return nil
+	}
+	category := &Category{Env: course.Env}
+	_, err := category.GetByID(*course.CategoryID)
 	return err
 }
-func (course *Course) Delete() error {
-	sql, err := course.Env.DB.Prepare("DELETE FROM course WHERE id=?")
+
+func (course *Course) loadTags(courses []*Course) error {
+	IDs := make([]int64, len(courses))
+	for i, c := range courses {
+		IDs[i] = c.ID
+	}
+	tags, err := courseTags(course.Env.DB, IDs)
 	if err != nil {
 		return err
 	}
-	_, err = sql.Exec(&course.ID)
-	return err
+	for _, c := range courses {
+		c.Tags = tags[c.ID]
+		if c.Tags == nil {
+			c.Tags = []string{}
+		}
+	}
+	return nil
+}
+
+// Facets counts the courses matching the filter, ignoring pagination, per
+// category and per tag.
+func (course *Course) Facets(f *filter.Filter) (*CourseFacets, error) {
+	facets := &CourseFacets{Categories: []*Facet{}, Tags: []*Facet{}}
+
+	matching, args, err := f.Filterize(course.listing().Select(goqu.I("id"))).ToSql()
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := course.Env.DB.Query("SELECT c.category_id, COALESCE(cat.name, ''), COUNT(*) FROM course c LEFT JOIN category cat ON cat.id = c.category_id "+
+		"WHERE c.id IN ("+matching+") GROUP BY c.category_id, cat.name ORDER BY COUNT(*) DESC", args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		facet := &Facet{}
+		if err := rows.Scan(&facet.ID, &facet.Name, &facet.Count); err != nil {
+			return nil, err
+		}
+		facets.Categories = append(facets.Categories, facet)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	rows, err = course.Env.DB.Query("SELECT t.id, t.name, COUNT(*) FROM course_tag ct JOIN tag t ON t.id = ct.tag_id "+
+		"WHERE ct.course_id IN ("+matching+") GROUP BY t.id, t.name ORDER BY COUNT(*) DESC, t.name", args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		facet := &Facet{}
+		if err := rows.Scan(&facet.ID, &facet.Name, &facet.Count); err != nil {
+			return nil, err
+		}
+		facets.Tags = append(facets.Tags, facet)
+	}
+	return facets, rows.Err()
+}
+
+// Delete moves the course to the trash, Purger removes it and its files for
+// good. A course that still has videos is only deleted with cascade, which
+// trashes the videos along with it.
+func (course *Course) Delete(cascade bool) error {
+	tx, err := course.Env.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var ID int64
+	err = tx.QueryRow("SELECT id FROM course WHERE id = ? AND deleted_at IS NULL FOR UPDATE", course.ID).Scan(&ID)
+	if err != nil {
+		return err
+	}
+
+	rows, err := tx.Query("SELECT id, name FROM video WHERE course_id = ? AND deleted_at IS NULL FOR UPDATE", course.ID)
+	if err != nil {
+		return err
+	}
+	dependent := &DependentVideosError{Videos: []*Video{}}
+	for rows.Next() {
+		v := &Video{CourseID: course.ID}
+		if err := rows.Scan(&v.ID, &v.Name); err != nil {
+			rows.Close()
+			return err
+		}
+		dependent.Videos = append(dependent.Videos, v)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	if len(dependent.Videos) > 0 && !cascade {
+		return dependent
+	}
+
+	// the videos share the deleted_at of the course so Restore can tell
+	// them apart from videos trashed on their own
+	deletedAt := time.Now()
+	if _, err = tx.Exec("UPDATE video SET deleted_at = ? WHERE course_id = ? AND deleted_at IS NULL", deletedAt, course.ID); err != nil {
+		return err
+	}
+	if _, err = tx.Exec("UPDATE course SET deleted_at = ? WHERE id = ?", deletedAt, course.ID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// Restore takes the course out of the trash together with the videos that
+// were deleted with it.
+func (course *Course) Restore() error {
+	tx, err := course.Env.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var deletedAt time.Time
+	err = tx.QueryRow("SELECT deleted_at FROM course WHERE id = ? AND deleted_at IS NOT NULL FOR UPDATE", course.ID).Scan(&deletedAt)
+	if err != nil {
+		return err
+	}
+	if _, err = tx.Exec("UPDATE video SET deleted_at = NULL WHERE course_id = ? AND deleted_at = ?", course.ID, deletedAt); err != nil {
+		return err
+	}
+	if err = restore(tx, "course", course.ID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// Exists tells whether the course is there and not in the trash.
+func (course *Course) Exists(ID int64) (bool, error) {
+	var found int64
+	err := course.Env.DB.QueryRow("SELECT id FROM course WHERE id = ? AND deleted_at IS NULL", ID).Scan(&found)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// IsVisible tells whether the course is published and its publish time has come.
+func (course *Course) IsVisible() bool {
+	return isVisible(course.Status, course.PublishAt)
+}
+
+func (course *Course) ChangeStatus(t *Transition) error {
+	return changeStatus(course.Env.DB, "course", course.ID, t)
+}
+
+func (course *Course) GetByIDs(IDs []int64) (map[int64]*Course, error) {
+	courses := make(map[int64]*Course)
+	if len(IDs) == 0 {
+		return courses, nil
+	}
+	in := make([]interface{}, len(IDs))
+	for i, ID := range IDs {
+		in[i] = ID
+	}
+
+	query := course.Env.QB.From(goqu.I("course")).Select(
+		goqu.I("id"),
+		goqu.I("name"),
+		goqu.I("description"),
+		goqu.I("cover"),
+		goqu.I("category_id"),
+		goqu.I("status"),
+		goqu.I("publish_at"),
+		goqu.I("created_at"),
+		goqu.I("updated_at")).Where(goqu.I("id").In(in...), goqu.I("deleted_at").IsNull()).Prepared(true)
+	sqlstring, args, _ := query.ToSql()
+
+	rows, err := course.Env.DB.Query(sqlstring, args...)
+	if err != nil {
+		return courses, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		c := &Course{Env: course.Env}
+		if err := rows.Scan(&c.ID, &c.Name, &c.Description, &c.Cover, &c.CategoryID, &c.Status, &c.PublishAt, &c.CreatedAt, &c.UpdatedAt); err != nil {
+			return courses, err
+		}
+		courses[c.ID] = c
+	}
+	return courses, rows.Err()
 }
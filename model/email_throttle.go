@@ -0,0 +1,56 @@
+package model
+
+import (
+	"strings"
+	"time"
+
+	"github.com/arizanovj/courses/env"
+)
+
+// EmailThrottle limits how many account emails, verifications and password
+// resets, can be asked for per address and per client IP within Window.
+// Requests are counted whether or not the address is registered.
+type EmailThrottle struct {
+	Env        *env.Env
+	EmailLimit int
+	IPLimit    int
+	Window     time.Duration
+}
+
+// Allow counts the request and returns how long the caller has to wait when
+// it is over either limit, zero otherwise.
+func (t *EmailThrottle) Allow(email string, ip string) (time.Duration, error) {
+	var wait time.Duration
+	keys := [][2]string{
+		{throttleAccount, strings.ToLower(email)},
+		{throttleIP, ip},
+	}
+	for _, k := range keys {
+		window := int64(t.Window.Seconds())
+		// a window that is over starts again with this request
+		_, err := t.Env.DB.Exec("INSERT INTO email_request (scope, `key`, requests, window_started_at) VALUES (?, ?, 1, NOW()) "+
+			"ON DUPLICATE KEY UPDATE requests = IF(window_started_at < NOW() - INTERVAL ? SECOND, 1, requests + 1), "+
+			"window_started_at = IF(window_started_at < NOW() - INTERVAL ? SECOND, NOW(), window_started_at)",
+			k[0], k[1], window, window)
+		if err != nil {
+			return 0, err
+		}
+
+		var requests int
+		var left int64
+		err = t.Env.DB.QueryRow("SELECT requests, TIMESTAMPDIFF(SECOND, NOW(), window_started_at + INTERVAL ? SECOND) FROM email_request WHERE scope = ? AND `key` = ?",
+			window, k[0], k[1]).Scan(&requests, &left)
+		if err != nil {
+			return 0, err
+		}
+
+		limit := t.EmailLimit
+		if k[0] == throttleIP {
+			limit = t.IPLimit
+		}
+		if d := time.Duration(left) * time.Second; requests > limit && d > wait {
+			wait = d
+		}
+	}
+	return wait, nil
+}
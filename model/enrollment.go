@@ -0,0 +1,207 @@
+package model
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/arizanovj/courses/env"
+	"github.com/arizanovj/courses/libs"
+	"github.com/arizanovj/courses/libs/filter"
+	"github.com/go-ozzo/ozzo-validation"
+	goqu "gopkg.in/doug-martin/goqu.v4"
+)
+
+const (
+	EnrollmentActive    = "active"
+	EnrollmentCancelled = "cancelled"
+)
+
+var (
+	ErrNotEnrolled       = errors.New("user is not enrolled in this course")
+	ErrEnrollmentExpired = errors.New("the enrollment has expired, only an administrator can renew it")
+)
+
+// ExpiryUpdate tells Enroll what to do with the expiry of an enrollment the
+// user already has.
+type ExpiryUpdate int
+
+const (
+	// KeepExpiry leaves it as it is and refuses to reactivate an expired
+	// enrollment, it is what users enrolling themselves get.
+	KeepExpiry ExpiryUpdate = iota
+	// RenewExpiry sets it to ExpiresAt only when the enrollment is being
+	// reactivated, active ones keep theirs.
+	RenewExpiry
+	// ReplaceExpiry sets it to ExpiresAt.
+	ReplaceExpiry
+)
+
+// mysqlDateTime is the layout of datetime columns, which are in UTC.
+const mysqlDateTime = "2006-01-02 15:04:05"
+
+// ParseExpiry checks an expiry sent by a client is an RFC 3339 time in the
+// future and returns it the way expires_at stores it.
+func ParseExpiry(expiresAt *string) (*string, error) {
+	err := validation.Errors{
+		"expires_at": validation.Validate(expiresAt, validation.NilOrNotEmpty, validation.Date(time.RFC3339).Min(time.Now()).RangeError("must be in the future")),
+	}.Filter()
+	if err != nil || expiresAt == nil {
+		return nil, err
+	}
+	parsed, _ := time.Parse(time.RFC3339, *expiresAt)
+	stored := parsed.UTC().Format(mysqlDateTime)
+	return &stored, nil
+}
+
+type Enrollment struct {
+	ID         int64   `json:"id" filter:"id,number"`
+	UserID     int64   `json:"user_id" filter:"user_id,number"`
+	CourseID   int64   `json:"course_id" filter:"course_id,number"`
+	Status     string  `json:"status" filter:"status,string"`
+	EnrolledAt string  `json:"enrolled_at" filter:"enrolled_at,date"`
+	ExpiresAt  *string `json:"expires_at" filter:"expires_at,date"`
+	UpdatedAt  string  `json:"updated_at" filter:"updated_at,date"`
+	Course     *Course `json:"course,omitempty" filter:"-"`
+	User       *User   `json:"user,omitempty" filter:"-"`
+	// UpdateExpiry is what Enroll does with the expiry of an existing
+	// enrollment, new ones always get ExpiresAt.
+	UpdateExpiry ExpiryUpdate `json:"-" filter:"-"`
+	Env          *env.Env     `json:"-"`
+}
+
+// GetForUser lists the enrollments of a user together with their courses.
+func (enrollment *Enrollment) GetForUser(userID int64, p *pagination.Paginator, f *filter.Filter) ([]*Enrollment, error) {
+	enrollments, err := enrollment.get(goqu.I("user_id").Eq(userID), p, f)
+	if err != nil || len(enrollments) == 0 {
+		return enrollments, err
+	}
+
+	IDs := make([]int64, len(enrollments))
+	for i, e := range enrollments {
+		IDs[i] = e.CourseID
+	}
+	course := &Course{Env: enrollment.Env}
+	courses, err := course.GetByIDs(IDs)
+	if err != nil {
+		return enrollments, err
+	}
+	for _, e := range enrollments {
+		e.Course = courses[e.CourseID]
+	}
+	return enrollments, nil
+}
+
+// GetForCourse lists the roster of a course.
+func (enrollment *Enrollment) GetForCourse(courseID int64, p *pagination.Paginator, f *filter.Filter) ([]*Enrollment, error) {
+	enrollments, err := enrollment.get(goqu.I("course_id").Eq(courseID), p, f)
+	if err != nil || len(enrollments) == 0 {
+		return enrollments, err
+	}
+
+	IDs := make([]int64, len(enrollments))
+	for i, e := range enrollments {
+		IDs[i] = e.UserID
+	}
+	user := &User{Env: enrollment.Env}
+	users, err := user.GetByIDs(IDs)
+	if err != nil {
+		return enrollments, err
+	}
+	for _, e := range enrollments {
+		e.User = users[e.UserID]
+	}
+	return enrollments, nil
+}
+
+func (enrollment *Enrollment) get(where goqu.Expression, p *pagination.Paginator, f *filter.Filter) ([]*Enrollment, error) {
+	enrollments := []*Enrollment{}
+
+	query := enrollment.Env.QB.From(goqu.I("enrollment")).Select(
+		goqu.I("id"),
+		goqu.I("user_id"),
+		goqu.I("course_id"),
+		goqu.I("status"),
+		goqu.I("enrolled_at"),
+		goqu.I("expires_at"),
+		goqu.I("updated_at")).Where(where).Order(goqu.I("enrolled_at").Desc()).Prepared(true)
+
+	p.PK = "id"
+	query = f.Filterize(query)
+	query = p.Paginate(query)
+
+	sqlstring, args, _ := query.ToSql()
+
+	rows, err := enrollment.Env.DB.Query(sqlstring, args...)
+	if err != nil {
+		return enrollments, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		e := new(Enrollment)
+		if err := rows.Scan(&e.ID, &e.UserID, &e.CourseID, &e.Status, &e.EnrolledAt, &e.ExpiresAt, &e.UpdatedAt); err != nil {
+			return nil, err
+		}
+		enrollments = append(enrollments, e)
+	}
+	return enrollments, rows.Err()
+}
+
+// execQuerier is what enroll needs from a DB or a transaction.
+type execQuerier interface {
+	execer
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+// Enroll creates the enrollment or reactivates a cancelled one, see
+// UpdateExpiry for what happens to the expiry of an existing one.
+func (enrollment *Enrollment) Enroll() error {
+	return enrollment.enroll(enrollment.Env.DB)
+}
+
+func (enrollment *Enrollment) enroll(db execQuerier) error {
+	if enrollment.UpdateExpiry == KeepExpiry {
+		var expired bool
+		err := db.QueryRow("SELECT expires_at <= NOW() FROM enrollment WHERE user_id = ? AND course_id = ? AND expires_at IS NOT NULL",
+			enrollment.UserID, enrollment.CourseID).Scan(&expired)
+		if err != nil && err != sql.ErrNoRows {
+			return err
+		}
+		if expired {
+			return ErrEnrollmentExpired
+		}
+	}
+
+	// expires_at goes first, assignments after it see the updated status
+	_, err := db.Exec("INSERT INTO enrollment (`user_id`,`course_id`,`status`,`enrolled_at`,`expires_at`) VALUES (?,?,?,NOW(),?) "+
+		"ON DUPLICATE KEY UPDATE `expires_at` = IF(? = ? OR (? = ? AND (`status` <> ? OR `expires_at` <= NOW())), VALUES(`expires_at`), `expires_at`), "+
+		"`enrolled_at` = IF(`status` = ?, `enrolled_at`, NOW()), `status` = VALUES(`status`)",
+		&enrollment.UserID, &enrollment.CourseID, EnrollmentActive, &enrollment.ExpiresAt,
+		enrollment.UpdateExpiry, ReplaceExpiry, enrollment.UpdateExpiry, RenewExpiry, EnrollmentActive, EnrollmentActive)
+	return err
+}
+
+func (enrollment *Enrollment) Unenroll() error {
+	result, err := enrollment.Env.DB.Exec("UPDATE enrollment SET `status` = ? WHERE user_id = ? AND course_id = ? AND `status` = ?", EnrollmentCancelled, &enrollment.UserID, &enrollment.CourseID, EnrollmentActive)
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrNotEnrolled
+	}
+	return nil
+}
+
+// IsActive tells whether the user currently has access to the course.
+func (enrollment *Enrollment) IsActive(userID int64, courseID int64) (bool, error) {
+	var ID int64
+	err := enrollment.Env.DB.QueryRow("SELECT id FROM enrollment WHERE user_id = ? AND course_id = ? AND `status` = ? AND (expires_at IS NULL OR expires_at > NOW())", userID, courseID, EnrollmentActive).Scan(&ID)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	return err == nil, err
+}
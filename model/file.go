@@ -1,48 +1,75 @@
 package model
 
 import (
-	"errors"
+	"crypto/rand"
+	"encoding/hex"
 	"io"
 	"mime/multipart"
 	"strings"
 
-	tempfile "github.com/mash/go-tempfile-suffix"
+	"github.com/arizanovj/courses/env"
+	"github.com/arizanovj/courses/storage"
 )
 
 type File struct {
-	File       multipart.File
-	Header     *multipart.FileHeader
-	Prefix     string
-	ValidTypes map[string]string
-	Path       string
+	File   multipart.File
+	Header *multipart.FileHeader
+	Prefix string
+	// ValidTypes are the MIME types accepted and the largest size of each.
+	ValidTypes map[string]int64
+	// Type is the MIME type Validate recognized the file as.
+	Type string
+	// Dir is the media directory of env.Env the file goes in.
+	Dir string
+	Env *env.Env
 }
 
+// SaveFile stores the file under a new name in Dir and returns the name.
 func (f *File) SaveFile() (string, error) {
-
-	file, err := tempfile.TempFileWithSuffix(f.Path, f.Prefix, "."+f.getExtensionFromName())
+	name, err := newFileName(f.Prefix, FileExtension(f.Type))
 	if err != nil {
 		return "", err
 	}
-	defer file.Close()
-	io.Copy(file, f.File)
-
-	dirs := strings.Split(file.Name(), "/")
-
-	return dirs[len(dirs)-1], nil
+	if _, err := f.File.Seek(0, io.SeekStart); err != nil {
+		return "", err
+	}
+	err = f.Env.Storage.Put(StorageKey(f.Dir, name), f.File, f.Header.Size, f.Type)
+	if err != nil {
+		return "", err
+	}
+	return name, nil
 }
 
-func (f *File) getExtensionFromName() string {
-	name := strings.Split(f.Header.Filename, ".")
-	return name[1]
+// Remove deletes the file called name from Dir, it not being there is fine.
+func (f *File) Remove(name string) error {
+	err := f.Env.Storage.Delete(StorageKey(f.Dir, name))
+	if err == storage.ErrNotFound {
+		return nil
+	}
+	return err
 }
 
+// Validate recognizes the file by its content, see CheckFileType, it
+// returns ErrFileType or a *FileTooLargeError for one that isn't accepted.
 func (f *File) Validate() error {
-
-	for extension, mime := range f.ValidTypes {
-		if mime == f.Header.Header["Content-Type"][0] && extension == f.getExtensionFromName() {
-			return nil
-		}
+	mime, err := CheckFileType(f.File, f.Header.Size, f.ValidTypes)
+	if err != nil {
+		return err
 	}
+	f.Type = mime
+	return nil
+}
 
-	return errors.New("invalid file type provided")
+// StorageKey is the key the file called name in dir, one of the media
+// directories of env.Env, is stored under.
+func StorageKey(dir string, name string) string {
+	return strings.TrimPrefix(dir, "/") + name
+}
+
+func newFileName(prefix string, extension string) (string, error) {
+	random := make([]byte, 8)
+	if _, err := rand.Read(random); err != nil {
+		return "", err
+	}
+	return prefix + hex.EncodeToString(random) + "." + extension, nil
 }
@@ -0,0 +1,209 @@
+package model
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+var ErrFileType = errors.New("invalid file type provided")
+
+// FileTooLargeError is returned for a file over the size limit of its type.
+type FileTooLargeError struct {
+	Type    string
+	MaxSize int64
+}
+
+func (e *FileTooLargeError) Error() string {
+	return fmt.Sprintf("%s files can't be larger than %d bytes", e.Type, e.MaxSize)
+}
+
+// sniffLen is how much of a file is read to recognize it, enough for the
+// brands of an MP4 ftyp box and the header of a WebM file.
+const sniffLen = 4096
+
+// fileTypes are the formats files are recognized as, with the extension
+// they are stored under.
+var fileTypes = []struct {
+	MIME      string
+	Extension string
+	Match     func(head []byte) bool
+}{
+	{"image/png", "png", isPNG},
+	{"image/jpeg", "jpg", isJPEG},
+	{"image/webp", "webp", isWebP},
+	{"video/mp4", "mp4", isMP4},
+	{"video/webm", "webm", isWebM},
+}
+
+// CheckFileType recognizes the file in r by its content, whatever its name
+// and Content-Type claim, and checks it is one of types, MIME types mapped
+// to the largest size allowed for them. It returns the MIME type.
+func CheckFileType(r io.ReaderAt, size int64, types map[string]int64) (string, error) {
+	head := make([]byte, sniffLen)
+	n, err := r.ReadAt(head, 0)
+	if err != nil && err != io.EOF {
+		return "", err
+	}
+	mime := DetectFileType(head[:n])
+	maxSize, ok := types[mime]
+	if !ok {
+		return "", ErrFileType
+	}
+	if size > maxSize {
+		return "", &FileTooLargeError{Type: mime, MaxSize: maxSize}
+	}
+	return mime, nil
+}
+
+// DetectFileType returns the MIME type of the file starting with head, or
+// an empty string for a format that isn't known.
+func DetectFileType(head []byte) string {
+	for _, fileType := range fileTypes {
+		if fileType.Match(head) {
+			return fileType.MIME
+		}
+	}
+	return ""
+}
+
+func FileExtension(mime string) string {
+	for _, fileType := range fileTypes {
+		if fileType.MIME == mime {
+			return fileType.Extension
+		}
+	}
+	return ""
+}
+
+// isPNG wants the signature followed by the IHDR chunk every PNG starts with.
+func isPNG(head []byte) bool {
+	return len(head) >= 16 && bytes.Equal(head[:8], []byte("\x89PNG\r\n\x1a\n")) && string(head[12:16]) == "IHDR"
+}
+
+// isJPEG wants the SOI marker followed by another marker.
+func isJPEG(head []byte) bool {
+	return len(head) >= 3 && head[0] == 0xFF && head[1] == 0xD8 && head[2] == 0xFF
+}
+
+// isWebP wants a RIFF container of WEBP whose first chunk is one of the
+// lossy, lossless or extended formats.
+func isWebP(head []byte) bool {
+	if len(head) < 16 || string(head[:4]) != "RIFF" || string(head[8:12]) != "WEBP" {
+		return false
+	}
+	chunk := string(head[12:16])
+	return chunk == "VP8 " || chunk == "VP8L" || chunk == "VP8X"
+}
+
+// mp4Brands are the ftyp brands of MP4 files, QuickTime and HEIF images
+// share the box but not these.
+var mp4Brands = map[string]bool{
+	"isom": true, "iso2": true, "iso3": true, "iso4": true, "iso5": true, "iso6": true,
+	"mp41": true, "mp42": true, "mp71": true, "avc1": true, "dash": true, "M4V ": true,
+}
+
+// isMP4 wants the file to start with an ftyp box naming an MP4 brand, as
+// the major brand or one of the compatible ones.
+func isMP4(head []byte) bool {
+	if len(head) < 16 || string(head[4:8]) != "ftyp" {
+		return false
+	}
+	size := int(binary.BigEndian.Uint32(head[:4]))
+	if size < 16 || size%4 != 0 {
+		return false
+	}
+	if size > len(head) {
+		size = len(head) - len(head)%4
+	}
+	if mp4Brands[string(head[8:12])] {
+		return true
+	}
+	// 12:16 is the minor version
+	for i := 16; i+4 <= size; i += 4 {
+		if mp4Brands[string(head[i:i+4])] {
+			return true
+		}
+	}
+	return false
+}
+
+const (
+	ebmlHeaderID = 0x1A45DFA3
+	ebmlDocType  = 0x4282
+)
+
+// isWebM wants an EBML header whose DocType is webm, Matroska files share
+// the container but not the DocType.
+func isWebM(head []byte) bool {
+	ID, n := ebmlID(head)
+	if n == 0 || ID != ebmlHeaderID {
+		return false
+	}
+	size, m := ebmlSize(head[n:])
+	if m == 0 {
+		return false
+	}
+	header := head[n+m:]
+	if size < uint64(len(header)) {
+		header = header[:size]
+	}
+	for len(header) > 0 {
+		ID, n := ebmlID(header)
+		if n == 0 {
+			return false
+		}
+		size, m := ebmlSize(header[n:])
+		if m == 0 || size > uint64(len(header)-n-m) {
+			return false
+		}
+		value := header[n+m : n+m+int(size)]
+		if ID == ebmlDocType {
+			return string(bytes.TrimRight(value, "\x00")) == "webm"
+		}
+		header = header[n+m+int(size):]
+	}
+	return false
+}
+
+// ebmlID reads an element ID, its length is told by the leading zero bits
+// of the first byte which, unlike in sizes, stay part of the value.
+func ebmlID(b []byte) (uint32, int) {
+	if len(b) == 0 {
+		return 0, 0
+	}
+	length := 1
+	for mask := byte(0x80); length <= 4 && b[0]&mask == 0; mask >>= 1 {
+		length++
+	}
+	if length > 4 || length > len(b) {
+		return 0, 0
+	}
+	var ID uint32
+	for _, c := range b[:length] {
+		ID = ID<<8 | uint32(c)
+	}
+	return ID, length
+}
+
+// ebmlSize reads a variable length size, the marker bit dropped.
+func ebmlSize(b []byte) (uint64, int) {
+	if len(b) == 0 {
+		return 0, 0
+	}
+	length := 1
+	mask := byte(0x80)
+	for ; length <= 8 && b[0]&mask == 0; mask >>= 1 {
+		length++
+	}
+	if length > 8 || length > len(b) {
+		return 0, 0
+	}
+	size := uint64(b[0] & (mask - 1))
+	for _, c := range b[1:length] {
+		size = size<<8 | uint64(c)
+	}
+	return size, length
+}
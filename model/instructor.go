@@ -0,0 +1,188 @@
+package model
+
+import (
+	"database/sql"
+	"errors"
+
+	"github.com/arizanovj/courses/env"
+	"github.com/go-ozzo/ozzo-validation"
+)
+
+const (
+	InstructorOwner        = "owner"
+	InstructorCoInstructor = "co_instructor"
+)
+
+var (
+	ErrInstructorNotFound = errors.New("user is not an instructor of this course")
+	ErrLastOwner          = errors.New("a course needs at least one owner")
+	ErrNotInstructor      = errors.New("user is not an instructor")
+)
+
+type Instructor struct {
+	CourseID  int64    `json:"course_id"`
+	UserID    int64    `json:"user_id"`
+	Role      string   `json:"role"`
+	FirstName string   `json:"first_name"`
+	LastName  string   `json:"last_name"`
+	CreatedAt string   `json:"created_at"`
+	Env       *env.Env `json:"-"`
+}
+
+// InstructorProfile is the public page of an instructor.
+type InstructorProfile struct {
+	ID        int64     `json:"id"`
+	FirstName string    `json:"first_name"`
+	LastName  string    `json:"last_name"`
+	Courses   []*Course `json:"courses"`
+}
+
+func (i Instructor) Validate() error {
+	return validation.ValidateStruct(&i,
+		validation.Field(&i.UserID, validation.Required),
+		validation.Field(&i.Role, validation.Required, validation.In(InstructorOwner, InstructorCoInstructor)),
+	)
+}
+
+func (i *Instructor) GetForCourse(courseID int64) ([]*Instructor, error) {
+	instructors := []*Instructor{}
+	rows, err := i.Env.DB.Query("SELECT ci.course_id, ci.user_id, ci.role, u.first_name, u.last_name, ci.created_at FROM course_instructor ci "+
+		"JOIN `user` u ON u.id = ci.user_id WHERE ci.course_id = ? AND u.deleted_at IS NULL ORDER BY ci.role = ? DESC, ci.created_at", courseID, InstructorOwner)
+	if err != nil {
+		return instructors, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		instructor := &Instructor{Env: i.Env}
+		if err := rows.Scan(&instructor.CourseID, &instructor.UserID, &instructor.Role, &instructor.FirstName, &instructor.LastName, &instructor.CreatedAt); err != nil {
+			return instructors, err
+		}
+		instructors = append(instructors, instructor)
+	}
+	return instructors, rows.Err()
+}
+
+// RoleOf returns the role of the user on the course, empty if they don't
+// teach it.
+func (i *Instructor) RoleOf(courseID int64, userID int64) (string, error) {
+	var role string
+	err := i.Env.DB.QueryRow("SELECT role FROM course_instructor WHERE course_id = ? AND user_id = ?", courseID, userID).Scan(&role)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	return role, err
+}
+
+// Save adds the user to the course or changes their role.
+func (i *Instructor) Save() error {
+	user := &User{Env: i.Env}
+	user, err := user.GetByID(i.UserID)
+	if err != nil {
+		return err
+	}
+	if user.IsInstructor == nil || !*user.IsInstructor {
+		return ErrNotInstructor
+	}
+
+	tx, err := i.Env.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if i.Role != InstructorOwner {
+		if err := checkOtherOwner(tx, i.CourseID, i.UserID); err != nil {
+			return err
+		}
+	}
+	_, err = tx.Exec("INSERT INTO course_instructor (`course_id`,`user_id`,`role`) VALUES (?,?,?) ON DUPLICATE KEY UPDATE `role` = VALUES(`role`)", i.CourseID, i.UserID, i.Role)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (i *Instructor) Remove() error {
+	tx, err := i.Env.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := checkOtherOwner(tx, i.CourseID, i.UserID); err != nil {
+		return err
+	}
+	result, err := tx.Exec("DELETE FROM course_instructor WHERE course_id = ? AND user_id = ?", i.CourseID, i.UserID)
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrInstructorNotFound
+	}
+	return tx.Commit()
+}
+
+// checkOtherOwner makes sure the course keeps an owner besides the user.
+func checkOtherOwner(tx *sql.Tx, courseID int64, userID int64) error {
+	var owners int
+	err := tx.QueryRow("SELECT COUNT(*) FROM course_instructor WHERE course_id = ? AND role = ? AND user_id <> ? FOR UPDATE", courseID, InstructorOwner, userID).Scan(&owners)
+	if err != nil {
+		return err
+	}
+	var isOwner int
+	err = tx.QueryRow("SELECT COUNT(*) FROM course_instructor WHERE course_id = ? AND role = ? AND user_id = ?", courseID, InstructorOwner, userID).Scan(&isOwner)
+	if err != nil {
+		return err
+	}
+	if isOwner > 0 && owners == 0 {
+		return ErrLastOwner
+	}
+	return nil
+}
+
+// Profile lists the published courses an instructor teaches.
+func (i *Instructor) Profile(userID int64) (*InstructorProfile, error) {
+	user := &User{Env: i.Env}
+	user, err := user.GetByID(userID)
+	if err != nil {
+		return nil, err
+	}
+	if user.IsInstructor == nil || !*user.IsInstructor {
+		return nil, ErrNotInstructor
+	}
+
+	rows, err := i.Env.DB.Query("SELECT c.id FROM course_instructor ci JOIN course c ON c.id = ci.course_id "+
+		"WHERE ci.user_id = ? AND c.deleted_at IS NULL AND "+visibleSQL("c")+" ORDER BY c.publish_at DESC", userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	IDs := []int64{}
+	for rows.Next() {
+		var ID int64
+		if err := rows.Scan(&ID); err != nil {
+			return nil, err
+		}
+		IDs = append(IDs, ID)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	course := &Course{Env: i.Env}
+	byID, err := course.GetByIDs(IDs)
+	if err != nil {
+		return nil, err
+	}
+	profile := &InstructorProfile{ID: user.ID, FirstName: user.FirstName, LastName: user.LastName, Courses: []*Course{}}
+	for _, ID := range IDs {
+		if c, ok := byID[ID]; ok {
+			profile.Courses = append(profile.Courses, c)
+		}
+	}
+	return profile, nil
+}
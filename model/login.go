@@ -2,30 +2,45 @@ package model
 
 import (
 	"database/sql"
+	"errors"
 
 	"github.com/go-ozzo/ozzo-validation/is"
+	"golang.org/x/crypto/bcrypt"
 
 	"github.com/go-ozzo/ozzo-validation"
 )
 
+var (
+	ErrEmailNotVerified   = errors.New("email address has not been verified")
+	ErrInvalidCredentials = errors.New("wrong email or password")
+	ErrUserNotFound       = errors.New("there is no user with such email")
+)
+
 type Login struct {
 	Email    string `json:"email"`
 	Password string `json:"password"`
 	DB       *sql.DB
 }
 
-func (l *Login) Login() (error, bool) {
+func (l *Login) Login() (*User, error) {
 	userModel := User{DB: l.DB}
 	user, err := userModel.FindByEmail(l.Email)
-	if err != nil {
-		return err, false
+	if err == ErrUserNotFound {
+		return nil, ErrInvalidCredentials
+	} else if err != nil {
+		return nil, err
 	}
 	err = user.ValidatePassword(l.Password)
-	if err != nil {
-		return err, false
+	if err == bcrypt.ErrMismatchedHashAndPassword {
+		return nil, ErrInvalidCredentials
+	} else if err != nil {
+		return nil, err
+	}
+	if user.VerifiedAt == nil {
+		return nil, ErrEmailNotVerified
 	}
 
-	return nil, true
+	return user, nil
 }
 
 func (l Login) Validate() error {
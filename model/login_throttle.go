@@ -0,0 +1,110 @@
+package model
+
+import (
+	"database/sql"
+	"strings"
+	"time"
+
+	"github.com/arizanovj/courses/env"
+)
+
+const (
+	throttleAccount = "account"
+	throttleIP      = "ip"
+)
+
+// LoginThrottle tracks failed logins per account and per client IP. Once a
+// key reaches its threshold every further failure locks it for twice as
+// long as the previous one, starting at BaseLockout and capped at MaxLockout.
+// Failures older than Window are forgotten.
+type LoginThrottle struct {
+	Env              *env.Env
+	AccountThreshold int
+	IPThreshold      int
+	BaseLockout      time.Duration
+	MaxLockout       time.Duration
+	Window           time.Duration
+}
+
+// Check returns how long the caller has to wait before trying again, zero
+// when neither the account nor the IP is locked.
+func (t *LoginThrottle) Check(email string, ip string) (time.Duration, error) {
+	var wait time.Duration
+	for _, k := range t.keys(email, ip) {
+		var lockedUntil *time.Time
+		err := t.Env.DB.QueryRow("SELECT locked_until FROM login_failure WHERE scope = ? AND `key` = ?", k[0], k[1]).Scan(&lockedUntil)
+		if err == sql.ErrNoRows {
+			continue
+		} else if err != nil {
+			return 0, err
+		}
+		if lockedUntil != nil {
+			if d := time.Until(*lockedUntil); d > wait {
+				wait = d
+			}
+		}
+	}
+	return wait, nil
+}
+
+func (t *LoginThrottle) Fail(email string, ip string) error {
+	for _, k := range t.keys(email, ip) {
+		_, err := t.Env.DB.Exec("INSERT INTO login_failure (scope, `key`, failures, last_failed_at) VALUES (?, ?, 1, NOW()) "+
+			"ON DUPLICATE KEY UPDATE failures = IF(last_failed_at < NOW() - INTERVAL ? SECOND, 1, failures + 1), last_failed_at = NOW()",
+			k[0], k[1], int64(t.Window.Seconds()))
+		if err != nil {
+			return err
+		}
+
+		var failures int
+		err = t.Env.DB.QueryRow("SELECT failures FROM login_failure WHERE scope = ? AND `key` = ?", k[0], k[1]).Scan(&failures)
+		if err != nil {
+			return err
+		}
+
+		if lockout := t.lockout(k[0], failures); lockout > 0 {
+			_, err = t.Env.DB.Exec("UPDATE login_failure SET locked_until = ? WHERE scope = ? AND `key` = ?", time.Now().Add(lockout), k[0], k[1])
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Succeed forgets the failures of the account. The IP keeps its record so a
+// single valid account can't be used to reset an attacker's counter.
+func (t *LoginThrottle) Succeed(email string) error {
+	return t.Unlock(email)
+}
+
+func (t *LoginThrottle) Unlock(email string) error {
+	_, err := t.Env.DB.Exec("DELETE FROM login_failure WHERE scope = ? AND `key` = ?", throttleAccount, strings.ToLower(email))
+	return err
+}
+
+func (t *LoginThrottle) lockout(scope string, failures int) time.Duration {
+	threshold := t.AccountThreshold
+	if scope == throttleIP {
+		threshold = t.IPThreshold
+	}
+	if failures < threshold {
+		return 0
+	}
+
+	lockout := t.BaseLockout
+	for i := threshold; i < failures && lockout < t.MaxLockout; i++ {
+		lockout *= 2
+	}
+	if lockout > t.MaxLockout {
+		lockout = t.MaxLockout
+	}
+	return lockout
+}
+
+func (t *LoginThrottle) keys(email string, ip string) [][2]string {
+	return [][2]string{
+		{throttleAccount, strings.ToLower(email)},
+		{throttleIP, ip},
+	}
+}
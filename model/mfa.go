@@ -0,0 +1,181 @@
+package model
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/base32"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/arizanovj/courses/auth"
+	"github.com/arizanovj/courses/env"
+	"github.com/pquerna/otp/totp"
+)
+
+const (
+	recoveryCodeCount = 10
+	totpPeriod        = 30
+)
+
+var (
+	ErrInvalidMFACode   = errors.New("invalid authentication code")
+	ErrMFANotEnrolled   = errors.New("multi-factor authentication is not set up")
+	ErrMFAAlreadyActive = errors.New("multi-factor authentication is already enabled")
+)
+
+type MFAEnrollment struct {
+	Secret string `json:"secret"`
+	URI    string `json:"uri"`
+}
+
+// MFA implements RFC 6238 time based one time passwords with single use
+// recovery codes.
+type MFA struct {
+	Issuer string
+	Env    *env.Env
+}
+
+// Enroll stores a fresh secret for the user. It is not enforced until
+// Confirm proves that the authenticator app produces valid codes.
+func (m *MFA) Enroll(userID int64, email string) (*MFAEnrollment, error) {
+	var enabledAt *string
+	err := m.Env.DB.QueryRow("SELECT mfa_enabled_at FROM `user` WHERE id = ?", userID).Scan(&enabledAt)
+	if err != nil {
+		return nil, err
+	}
+	if enabledAt != nil {
+		return nil, ErrMFAAlreadyActive
+	}
+
+	key, err := totp.Generate(totp.GenerateOpts{Issuer: m.Issuer, AccountName: email})
+	if err != nil {
+		return nil, err
+	}
+	_, err = m.Env.DB.Exec("UPDATE `user` SET mfa_secret = ?, mfa_last_step = 0 WHERE id = ?", key.Secret(), userID)
+	if err != nil {
+		return nil, err
+	}
+	return &MFAEnrollment{Secret: key.Secret(), URI: key.URL()}, nil
+}
+
+// Confirm enables MFA and returns the recovery codes. They are only ever
+// available in plain text here.
+func (m *MFA) Confirm(userID int64, code string) ([]string, error) {
+	tx, err := m.Env.DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var secret *string
+	var enabledAt *string
+	var lastStep int64
+	err = tx.QueryRow("SELECT mfa_secret, mfa_enabled_at, mfa_last_step FROM `user` WHERE id = ? FOR UPDATE", userID).Scan(&secret, &enabledAt, &lastStep)
+	if err != nil {
+		return nil, err
+	}
+	if secret == nil {
+		return nil, ErrMFANotEnrolled
+	}
+	if enabledAt != nil {
+		return nil, ErrMFAAlreadyActive
+	}
+	step, ok := matchTOTP(*secret, code, lastStep)
+	if !ok {
+		return nil, ErrInvalidMFACode
+	}
+
+	if _, err = tx.Exec("UPDATE `user` SET mfa_enabled_at = NOW(), mfa_last_step = ? WHERE id = ?", step, userID); err != nil {
+		return nil, err
+	}
+	if _, err = tx.Exec("DELETE FROM mfa_recovery_code WHERE user_id = ?", userID); err != nil {
+		return nil, err
+	}
+	codes := make([]string, recoveryCodeCount)
+	for i := range codes {
+		if codes[i], err = newRecoveryCode(); err != nil {
+			return nil, err
+		}
+		if _, err = tx.Exec("INSERT INTO mfa_recovery_code (`user_id`,`code_hash`) VALUES (?,?)", userID, auth.HashToken(codes[i])); err != nil {
+			return nil, err
+		}
+	}
+
+	return codes, tx.Commit()
+}
+
+// Verify accepts either a current TOTP code or an unused recovery code.
+// A TOTP code can't be replayed within its validity window.
+func (m *MFA) Verify(userID int64, code string) error {
+	tx, err := m.Env.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var secret *string
+	var enabledAt *string
+	var lastStep int64
+	err = tx.QueryRow("SELECT mfa_secret, mfa_enabled_at, mfa_last_step FROM `user` WHERE id = ? FOR UPDATE", userID).Scan(&secret, &enabledAt, &lastStep)
+	if err != nil {
+		return err
+	}
+	if secret == nil || enabledAt == nil {
+		return ErrMFANotEnrolled
+	}
+
+	if step, ok := matchTOTP(*secret, code, lastStep); ok {
+		if _, err = tx.Exec("UPDATE `user` SET mfa_last_step = ? WHERE id = ?", step, userID); err != nil {
+			return err
+		}
+		return tx.Commit()
+	}
+
+	var codeID int64
+	err = tx.QueryRow("SELECT id FROM mfa_recovery_code WHERE user_id = ? AND code_hash = ? AND used_at IS NULL", userID, auth.HashToken(normalizeRecoveryCode(code))).Scan(&codeID)
+	if err == sql.ErrNoRows {
+		return ErrInvalidMFACode
+	} else if err != nil {
+		return err
+	}
+	if _, err = tx.Exec("UPDATE mfa_recovery_code SET used_at = NOW() WHERE id = ?", codeID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// matchTOTP allows one step of clock drift either way and returns the
+// matched step so it can be recorded.
+func matchTOTP(secret string, code string, lastStep int64) (int64, bool) {
+	now := time.Now()
+	for _, skew := range []int64{0, -1, 1} {
+		t := now.Add(time.Duration(skew*totpPeriod) * time.Second)
+		step := t.Unix() / totpPeriod
+		if step <= lastStep {
+			continue
+		}
+		expected, err := totp.GenerateCode(secret, t)
+		if err == nil && expected == code {
+			return step, true
+		}
+	}
+	return 0, false
+}
+
+func newRecoveryCode() (string, error) {
+	b := make([]byte, 5)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	code := strings.ToLower(base32.StdEncoding.EncodeToString(b))
+	return code[:4] + "-" + code[4:], nil
+}
+
+func normalizeRecoveryCode(code string) string {
+	code = strings.ToLower(strings.Replace(strings.TrimSpace(code), "-", "", -1))
+	if len(code) != 8 {
+		return code
+	}
+	return code[:4] + "-" + code[4:]
+}
@@ -0,0 +1,160 @@
+package model
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/arizanovj/courses/auth"
+	"github.com/arizanovj/courses/env"
+	"golang.org/x/crypto/bcrypt"
+)
+
+var (
+	ErrInvalidOIDCState    = errors.New("unknown or expired login state")
+	ErrOIDCEmailUnverified = errors.New("the identity provider did not return a verified email")
+	ErrOIDCLinkRequired    = errors.New("sign in with your password and link the identity provider to your account first")
+	ErrOIDCIdentityTaken   = errors.New("the identity provider account is linked to another user")
+)
+
+// OIDCLogin keeps the state, nonce and PKCE verifier of a login that was
+// sent to the identity provider until it comes back. UserID is set when the
+// login links the provider account to that user instead.
+type OIDCLogin struct {
+	State    string `json:"-"`
+	Nonce    string `json:"-"`
+	Verifier string `json:"-"`
+	UserID   *int64 `json:"-"`
+	Env      *env.Env
+}
+
+func (l *OIDCLogin) Begin(ttl time.Duration) (*OIDCLogin, error) {
+	login := &OIDCLogin{UserID: l.UserID, Env: l.Env}
+	for _, v := range []*string{&login.State, &login.Nonce, &login.Verifier} {
+		token, err := auth.NewToken()
+		if err != nil {
+			return nil, err
+		}
+		*v = token
+	}
+	_, err := l.Env.DB.Exec("INSERT INTO oidc_login (`state_hash`,`nonce`,`code_verifier`,`user_id`,`expires_at`) VALUES (?,?,?,?,?) ",
+		auth.HashToken(login.State), login.Nonce, login.Verifier, login.UserID, time.Now().Add(ttl))
+	if err != nil {
+		return nil, err
+	}
+	return login, nil
+}
+
+// Finish looks up and deletes the pending login, so a state can only be used once.
+func (l *OIDCLogin) Finish(state string) (*OIDCLogin, error) {
+	tx, err := l.Env.DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	login := &OIDCLogin{State: state, Env: l.Env}
+	var expiresAt time.Time
+	err = tx.QueryRow("SELECT nonce, code_verifier, user_id, expires_at FROM oidc_login WHERE state_hash = ? FOR UPDATE", auth.HashToken(state)).Scan(&login.Nonce, &login.Verifier, &login.UserID, &expiresAt)
+	if err == sql.ErrNoRows {
+		return nil, ErrInvalidOIDCState
+	} else if err != nil {
+		return nil, err
+	}
+	if _, err = tx.Exec("DELETE FROM oidc_login WHERE state_hash = ? OR expires_at < NOW()", auth.HashToken(state)); err != nil {
+		return nil, err
+	}
+	if err = tx.Commit(); err != nil {
+		return nil, err
+	}
+	if expiresAt.Before(time.Now()) {
+		return nil, ErrInvalidOIDCState
+	}
+	return login, nil
+}
+
+// FindOrProvisionOIDC returns the user linked to the provider account. An
+// unknown account is linked to the user with the same verified email, or a
+// new non admin user is created for it. Admins are never linked this way,
+// whoever controls their email at the provider would get their rights, they
+// have to use LinkOIDC.
+func (user *User) FindOrProvisionOIDC(claims *auth.OIDCClaims) (*User, error) {
+	tx, err := user.Env.DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var ID int64
+	err = tx.QueryRow("SELECT user_id FROM user_identity WHERE issuer = ? AND subject = ?", claims.Issuer, claims.Subject).Scan(&ID)
+	if err != nil && err != sql.ErrNoRows {
+		return nil, err
+	}
+
+	if err == sql.ErrNoRows {
+		if claims.Email == "" || !claims.EmailVerified {
+			return nil, ErrOIDCEmailUnverified
+		}
+
+		var isAdmin bool
+		err = tx.QueryRow("SELECT id, is_admin FROM `user` WHERE email = ? AND deleted_at IS NULL", claims.Email).Scan(&ID, &isAdmin)
+		if err == sql.ErrNoRows {
+			ID, err = provisionOIDCUser(tx, claims)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if isAdmin {
+			return nil, ErrOIDCLinkRequired
+		}
+
+		_, err = tx.Exec("INSERT INTO user_identity (`user_id`,`issuer`,`subject`) VALUES (?,?,?)", ID, claims.Issuer, claims.Subject)
+		if err != nil {
+			return nil, err
+		}
+		linked := &User{ID: ID}
+		if err = linked.MarkEmailVerified(tx); err != nil {
+			return nil, err
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, err
+	}
+	found := &User{Env: user.Env}
+	return found.GetByID(ID)
+}
+
+// LinkOIDC links the provider account to the user, who signed in otherwise.
+func (user *User) LinkOIDC(claims *auth.OIDCClaims) error {
+	var ID int64
+	err := user.Env.DB.QueryRow("SELECT user_id FROM user_identity WHERE issuer = ? AND subject = ?", claims.Issuer, claims.Subject).Scan(&ID)
+	if err == nil {
+		if ID == user.ID {
+			return nil
+		}
+		return ErrOIDCIdentityTaken
+	} else if err != sql.ErrNoRows {
+		return err
+	}
+	_, err = user.Env.DB.Exec("INSERT INTO user_identity (`user_id`,`issuer`,`subject`) VALUES (?,?,?)", user.ID, claims.Issuer, claims.Subject)
+	return err
+}
+
+func provisionOIDCUser(tx *sql.Tx, claims *auth.OIDCClaims) (int64, error) {
+	// the account can only sign in through the provider until a password is reset
+	password, err := auth.NewToken()
+	if err != nil {
+		return 0, err
+	}
+	bytes, err := bcrypt.GenerateFromPassword([]byte(password), 14)
+	if err != nil {
+		return 0, err
+	}
+	result, err := tx.Exec("INSERT INTO user (`email`,`first_name`,`last_name`,`password_hash`,`is_admin`,`email_verified_at`) VALUES (?,?,?,?,0,NOW()) ",
+		claims.Email, claims.GivenName, claims.FamilyName, bytes)
+	if err != nil {
+		return 0, err
+	}
+	return result.LastInsertId()
+}
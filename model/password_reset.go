@@ -0,0 +1,51 @@
+package model
+
+import (
+	"database/sql"
+
+	"github.com/arizanovj/courses/env"
+	"github.com/go-ozzo/ozzo-validation"
+	"golang.org/x/crypto/bcrypt"
+)
+
+type PasswordReset struct {
+	Token    string   `json:"token"`
+	Password string   `json:"password"`
+	Env      *env.Env `json:"-"`
+}
+
+func (pr PasswordReset) Validate() error {
+	return validation.ValidateStruct(&pr,
+		validation.Field(&pr.Token, validation.Required),
+		validation.Field(&pr.Password, validation.Required, validation.Length(8, 20)),
+	)
+}
+
+// Reset spends the reset token, stores the new password and signs the user
+// out everywhere, all in one transaction.
+func (pr *PasswordReset) Reset() (int64, error) {
+	bytes, err := bcrypt.GenerateFromPassword([]byte(pr.Password), 14)
+	if err != nil {
+		return 0, err
+	}
+
+	userToken := &UserToken{Env: pr.Env}
+	t, err := userToken.Consume(pr.Token, TokenPasswordReset, func(tx *sql.Tx, t *UserToken) error {
+		if _, err := tx.Exec("UPDATE user SET password_hash = ? WHERE id = ?", bytes, t.UserID); err != nil {
+			return err
+		}
+		if _, err := tx.Exec("UPDATE user_token SET used_at = NOW() WHERE user_id = ? AND purpose = ? AND used_at IS NULL", t.UserID, TokenPasswordReset); err != nil {
+			return err
+		}
+		// the reset link was delivered to the mailbox, which proves ownership
+		user := &User{ID: t.UserID}
+		if err := user.MarkEmailVerified(tx); err != nil {
+			return err
+		}
+		return revokeSessionsForUser(tx, t.UserID)
+	})
+	if err != nil {
+		return 0, err
+	}
+	return t.UserID, nil
+}
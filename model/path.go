@@ -0,0 +1,293 @@
+package model
+
+import (
+	"database/sql"
+	"errors"
+
+	"github.com/arizanovj/courses/env"
+	"github.com/go-ozzo/ozzo-validation"
+)
+
+var ErrPathNotFound = errors.New("there is no such learning path")
+
+// LearningPath chains courses into a track that is enrolled in at once.
+type LearningPath struct {
+	ID          int64     `json:"id"`
+	Name        string    `json:"name"`
+	Description *string   `json:"description"`
+	CourseIDs   []int64   `json:"course_ids"`
+	Courses     []*Course `json:"courses"`
+	CreatedAt   string    `json:"created_at"`
+	UpdatedAt   string    `json:"updated_at"`
+	// OnlyPublished leaves the courses that aren't visible yet out of the path.
+	OnlyPublished bool     `json:"-"`
+	Env           *env.Env `json:"-"`
+}
+
+type PathProgress struct {
+	PathID           int64             `json:"path_id"`
+	TotalCourses     int               `json:"total_courses"`
+	CompletedCourses int               `json:"completed_courses"`
+	TotalVideos      int               `json:"total_videos"`
+	CompletedVideos  int               `json:"completed_videos"`
+	Percent          float64           `json:"percent"`
+	WatchedSeconds   int64             `json:"watched_seconds"`
+	Courses          []*CourseProgress `json:"courses"`
+}
+
+func (p LearningPath) Validate() error {
+	return validation.ValidateStruct(&p,
+		validation.Field(&p.Name, validation.Required, validation.Length(1, 255)),
+	)
+}
+
+func (p *LearningPath) GetAll() ([]*LearningPath, error) {
+	paths := []*LearningPath{}
+	rows, err := p.Env.DB.Query("SELECT id, name, description, created_at, updated_at FROM learning_path ORDER BY name")
+	if err != nil {
+		return paths, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		path := &LearningPath{OnlyPublished: p.OnlyPublished, Env: p.Env}
+		if err := rows.Scan(&path.ID, &path.Name, &path.Description, &path.CreatedAt, &path.UpdatedAt); err != nil {
+			return paths, err
+		}
+		paths = append(paths, path)
+	}
+	if err := rows.Err(); err != nil {
+		return paths, err
+	}
+	rows.Close()
+
+	for _, path := range paths {
+		if err := path.loadCourses(); err != nil {
+			return paths, err
+		}
+	}
+	return paths, nil
+}
+
+// GetByID loads the path with its courses in order.
+func (p *LearningPath) GetByID(ID int64) (*LearningPath, error) {
+	err := p.Env.DB.QueryRow("SELECT id, name, description, created_at, updated_at FROM learning_path WHERE id = ?", ID).
+		Scan(&p.ID, &p.Name, &p.Description, &p.CreatedAt, &p.UpdatedAt)
+	if err == sql.ErrNoRows {
+		return &LearningPath{}, ErrPathNotFound
+	} else if err != nil {
+		return &LearningPath{}, err
+	}
+	if err := p.loadCourses(); err != nil {
+		return &LearningPath{}, err
+	}
+	return p, nil
+}
+
+func (p *LearningPath) Create() (int64, error) {
+	tx, err := p.Env.DB.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec("INSERT INTO learning_path (`name`,`description`) VALUES (?,?)", &p.Name, &p.Description)
+	if err != nil {
+		return 0, err
+	}
+	lastID, err := result.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+	if err := p.setCourses(tx, lastID); err != nil {
+		return 0, err
+	}
+	return lastID, tx.Commit()
+}
+
+// Update replaces the path's courses when CourseIDs is given.
+func (p *LearningPath) Update() error {
+	tx, err := p.Env.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec("UPDATE learning_path SET `name` = ?, `description` = ? WHERE id = ?", &p.Name, &p.Description, &p.ID)
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		if _, err := (&LearningPath{Env: p.Env}).GetByID(p.ID); err != nil {
+			return err
+		}
+	}
+	if p.CourseIDs != nil {
+		if err := p.setCourses(tx, p.ID); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// Delete removes the path, enrollments into its courses stay.
+func (p *LearningPath) Delete() error {
+	result, err := p.Env.DB.Exec("DELETE FROM learning_path WHERE id = ?", p.ID)
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrPathNotFound
+	}
+	return nil
+}
+
+// Enroll enrolls the user into the path and every course of it, update is
+// what happens to the expiry of the course enrollments the user already has.
+func (p *LearningPath) Enroll(userID int64, expiresAt *string, update ExpiryUpdate) error {
+	tx, err := p.Env.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec("INSERT INTO learning_path_enrollment (`user_id`,`path_id`) VALUES (?,?) ON DUPLICATE KEY UPDATE `enrolled_at` = `enrolled_at`", userID, p.ID)
+	if err != nil {
+		return err
+	}
+	for _, course := range p.Courses {
+		enrollment := &Enrollment{UserID: userID, CourseID: course.ID, ExpiresAt: expiresAt, UpdateExpiry: update}
+		if err := enrollment.enroll(tx); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// CheckPrerequisites returns a MissingPrerequisitesError listing the
+// prerequisites of the path's courses that the user hasn't completed and
+// the path itself doesn't cover.
+func (p *LearningPath) CheckPrerequisites(userID int64) error {
+	inPath := make(map[int64]bool, len(p.Courses))
+	for _, course := range p.Courses {
+		inPath[course.ID] = true
+	}
+
+	missing := &MissingPrerequisitesError{Courses: []*Course{}}
+	seen := make(map[int64]bool)
+	for _, course := range p.Courses {
+		err := course.CheckPrerequisites(userID)
+		courseMissing, ok := err.(*MissingPrerequisitesError)
+		if err != nil && !ok {
+			return err
+		}
+		if !ok {
+			continue
+		}
+		for _, prerequisite := range courseMissing.Courses {
+			if !inPath[prerequisite.ID] && !seen[prerequisite.ID] {
+				seen[prerequisite.ID] = true
+				missing.Courses = append(missing.Courses, prerequisite)
+			}
+		}
+	}
+	if len(missing.Courses) > 0 {
+		return missing
+	}
+	return nil
+}
+
+// Progress sums up the progress of the user over the courses of the path,
+// videos are weighted equally whichever course they belong to.
+func (p *LearningPath) Progress(userID int64) (*PathProgress, error) {
+	path := &PathProgress{PathID: p.ID, TotalCourses: len(p.Courses), Courses: []*CourseProgress{}}
+	progress := &VideoProgress{Env: p.Env}
+	for _, course := range p.Courses {
+		c, err := progress.ForCourse(userID, course.ID)
+		if err != nil {
+			return nil, err
+		}
+		if c.IsComplete() {
+			path.CompletedCourses++
+		}
+		path.TotalVideos += c.TotalVideos
+		path.CompletedVideos += c.CompletedVideos
+		path.WatchedSeconds += c.WatchedSeconds
+		path.Courses = append(path.Courses, c)
+	}
+	if path.TotalVideos > 0 {
+		path.Percent = float64(path.CompletedVideos) * 100 / float64(path.TotalVideos)
+	}
+	return path, nil
+}
+
+// loadCourses loads the courses of the path in order.
+func (p *LearningPath) loadCourses() error {
+	rows, err := p.Env.DB.Query("SELECT course_id FROM learning_path_course WHERE path_id = ? ORDER BY position", p.ID)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	IDs := []int64{}
+	for rows.Next() {
+		var ID int64
+		if err := rows.Scan(&ID); err != nil {
+			return err
+		}
+		IDs = append(IDs, ID)
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	courses, err := (&Course{Env: p.Env}).byIDs(IDs)
+	if err != nil {
+		return err
+	}
+	p.CourseIDs = []int64{}
+	p.Courses = []*Course{}
+	for _, course := range courses {
+		if p.OnlyPublished && !course.IsVisible() {
+			continue
+		}
+		p.CourseIDs = append(p.CourseIDs, course.ID)
+		p.Courses = append(p.Courses, course)
+	}
+	return nil
+}
+
+// setCourses replaces the courses of the path keeping the order of
+// CourseIDs, repeated courses keep their first place.
+func (p *LearningPath) setCourses(tx *sql.Tx, pathID int64) error {
+	if _, err := tx.Exec("DELETE FROM learning_path_course WHERE path_id = ?", pathID); err != nil {
+		return err
+	}
+	course := &Course{Env: p.Env}
+	seen := make(map[int64]bool)
+	position := 0
+	for _, ID := range p.CourseIDs {
+		if seen[ID] {
+			continue
+		}
+		seen[ID] = true
+		exists, err := course.Exists(ID)
+		if err != nil {
+			return err
+		}
+		if !exists {
+			return ErrCourseNotFound
+		}
+		position++
+		if _, err := tx.Exec("INSERT INTO learning_path_course (`path_id`,`course_id`,`position`) VALUES (?,?,?)", pathID, ID, position); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,205 @@
+package model
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+)
+
+var ErrPrerequisiteCycle = errors.New("prerequisites can't form a cycle")
+
+// MissingPrerequisitesError is returned when a user hasn't completed the
+// prerequisites of a course yet.
+type MissingPrerequisitesError struct {
+	Courses []*Course
+}
+
+func (e *MissingPrerequisitesError) Error() string {
+	return fmt.Sprintf("%d prerequisite courses are not completed", len(e.Courses))
+}
+
+type PrerequisiteEdge struct {
+	CourseID       int64 `json:"course_id"`
+	PrerequisiteID int64 `json:"prerequisite_id"`
+}
+
+// PrerequisiteGraph holds every course a course depends on, directly or
+// through other prerequisites, and the edges between them.
+type PrerequisiteGraph struct {
+	CourseID int64               `json:"course_id"`
+	Courses  []*Course           `json:"courses"`
+	Edges    []*PrerequisiteEdge `json:"edges"`
+}
+
+// GetPrerequisites lists the courses that have to be completed before this one.
+func (course *Course) GetPrerequisites() ([]*Course, error) {
+	edges, err := prerequisiteEdges(course.Env.DB, false)
+	if err != nil {
+		return nil, err
+	}
+	return course.byIDs(edges[course.ID])
+}
+
+// SetPrerequisites replaces the direct prerequisites of the course,
+// refusing any that would make the course depend on itself.
+func (course *Course) SetPrerequisites(IDs []int64) error {
+	for _, ID := range IDs {
+		exists, err := course.Exists(ID)
+		if err != nil {
+			return err
+		}
+		if !exists {
+			return ErrCourseNotFound
+		}
+	}
+
+	tx, err := course.Env.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// trashed courses count as well, restoring one must not close a cycle.
+	// The lock keeps concurrent writers from closing one between them.
+	edges, err := prerequisiteEdges(tx, true)
+	if err != nil {
+		return err
+	}
+	edges[course.ID] = IDs
+	for _, ID := range IDs {
+		if ID == course.ID || dependsOn(edges, ID, course.ID) {
+			return ErrPrerequisiteCycle
+		}
+	}
+
+	if _, err := tx.Exec("DELETE FROM course_prerequisite WHERE course_id = ?", course.ID); err != nil {
+		return err
+	}
+	for _, ID := range IDs {
+		if _, err := tx.Exec("INSERT IGNORE INTO course_prerequisite (`course_id`,`prerequisite_id`) VALUES (?,?)", course.ID, ID); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// PrerequisiteGraph walks the prerequisites of the course down to the
+// courses that have none.
+func (course *Course) PrerequisiteGraph() (*PrerequisiteGraph, error) {
+	edges, err := prerequisiteEdges(course.Env.DB, false)
+	if err != nil {
+		return nil, err
+	}
+
+	graph := &PrerequisiteGraph{CourseID: course.ID, Edges: []*PrerequisiteEdge{}}
+	IDs := []int64{}
+	seen := map[int64]bool{course.ID: true}
+	queue := []int64{course.ID}
+	for len(queue) > 0 {
+		ID := queue[0]
+		queue = queue[1:]
+		for _, prerequisite := range edges[ID] {
+			graph.Edges = append(graph.Edges, &PrerequisiteEdge{CourseID: ID, PrerequisiteID: prerequisite})
+			if !seen[prerequisite] {
+				seen[prerequisite] = true
+				IDs = append(IDs, prerequisite)
+				queue = append(queue, prerequisite)
+			}
+		}
+	}
+
+	graph.Courses, err = course.byIDs(IDs)
+	if err != nil {
+		return nil, err
+	}
+	return graph, nil
+}
+
+// CheckPrerequisites returns a MissingPrerequisitesError listing the direct
+// prerequisites the user hasn't completed.
+func (course *Course) CheckPrerequisites(userID int64) error {
+	prerequisites, err := course.GetPrerequisites()
+	if err != nil {
+		return err
+	}
+
+	missing := &MissingPrerequisitesError{Courses: []*Course{}}
+	progress := &VideoProgress{Env: course.Env}
+	for _, prerequisite := range prerequisites {
+		p, err := progress.ForCourse(userID, prerequisite.ID)
+		if err != nil {
+			return err
+		}
+		if !p.IsComplete() {
+			missing.Courses = append(missing.Courses, prerequisite)
+		}
+	}
+	if len(missing.Courses) > 0 {
+		return missing
+	}
+	return nil
+}
+
+// byIDs loads the courses keeping the order of IDs, deleted ones are left out.
+func (course *Course) byIDs(IDs []int64) ([]*Course, error) {
+	byID, err := course.GetByIDs(IDs)
+	if err != nil {
+		return nil, err
+	}
+	courses := []*Course{}
+	for _, ID := range IDs {
+		if c, ok := byID[ID]; ok {
+			courses = append(courses, c)
+		}
+	}
+	return courses, nil
+}
+
+// querier is what reads need from a DB or a transaction.
+type querier interface {
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+}
+
+// prerequisiteEdges maps every course to its direct prerequisites. Reads
+// skip deleted courses on either side, forUpdate locks and returns every edge.
+func prerequisiteEdges(db querier, forUpdate bool) (map[int64][]int64, error) {
+	edges := make(map[int64][]int64)
+	query := "SELECT cp.course_id, cp.prerequisite_id FROM course_prerequisite cp " +
+		"JOIN course c ON c.id = cp.course_id JOIN course p ON p.id = cp.prerequisite_id " +
+		"WHERE c.deleted_at IS NULL AND p.deleted_at IS NULL ORDER BY cp.course_id, cp.prerequisite_id"
+	if forUpdate {
+		query = "SELECT course_id, prerequisite_id FROM course_prerequisite FOR UPDATE"
+	}
+	rows, err := db.Query(query)
+	if err != nil {
+		return edges, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var courseID, prerequisiteID int64
+		if err := rows.Scan(&courseID, &prerequisiteID); err != nil {
+			return edges, err
+		}
+		edges[courseID] = append(edges[courseID], prerequisiteID)
+	}
+	return edges, rows.Err()
+}
+
+// dependsOn tells whether target can be reached from ID following edges.
+func dependsOn(edges map[int64][]int64, ID int64, target int64) bool {
+	seen := make(map[int64]bool)
+	stack := []int64{ID}
+	for len(stack) > 0 {
+		current := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if current == target {
+			return true
+		}
+		if seen[current] {
+			continue
+		}
+		seen[current] = true
+		stack = append(stack, edges[current]...)
+	}
+	return false
+}
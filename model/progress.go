@@ -0,0 +1,148 @@
+package model
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/arizanovj/courses/env"
+)
+
+// maxReportedWatch caps the watch time accepted from a single report, so a
+// player can't claim more than it could have played since the last one.
+const maxReportedWatch = 5 * 60
+
+type VideoProgress struct {
+	UserID           int64    `json:"user_id"`
+	VideoID          int64    `json:"video_id"`
+	Position         int64    `json:"position"`
+	FurthestPosition int64    `json:"furthest_position"`
+	WatchedSeconds   int64    `json:"watched_seconds"`
+	CompletedAt      *string  `json:"completed_at"`
+	UpdatedAt        string   `json:"updated_at"`
+	Env              *env.Env `json:"-"`
+}
+
+type CourseProgress struct {
+	CourseID        int64            `json:"course_id"`
+	TotalVideos     int              `json:"total_videos"`
+	CompletedVideos int              `json:"completed_videos"`
+	Percent         float64          `json:"percent"`
+	WatchedSeconds  int64            `json:"watched_seconds"`
+	Videos          []*VideoProgress `json:"videos"`
+}
+
+// Get returns the progress of the user on the video, nil if they never played it.
+func (vp *VideoProgress) Get(userID int64, videoID int64) (*VideoProgress, error) {
+	p := &VideoProgress{Env: vp.Env}
+	err := vp.Env.DB.QueryRow("SELECT user_id, video_id, position, furthest_position, watched_seconds, completed_at, updated_at FROM video_progress WHERE user_id = ? AND video_id = ?", userID, videoID).
+		Scan(&p.UserID, &p.VideoID, &p.Position, &p.FurthestPosition, &p.WatchedSeconds, &p.CompletedAt, &p.UpdatedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// Report records a playback position and the seconds watched since the
+// previous report. The video is complete once both the furthest position
+// and the watch time reach threshold of its duration.
+func (vp *VideoProgress) Report(userID int64, video *Video, position int64, watched int64, threshold float64) (*VideoProgress, error) {
+	if watched < 0 {
+		watched = 0
+	}
+	if watched > maxReportedWatch {
+		watched = maxReportedWatch
+	}
+	if position < 0 {
+		position = 0
+	}
+	if video.Duration != nil && position > *video.Duration {
+		position = *video.Duration
+	}
+
+	tx, err := vp.Env.DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	p := &VideoProgress{UserID: userID, VideoID: video.ID, Env: vp.Env}
+	err = tx.QueryRow("SELECT furthest_position, watched_seconds, completed_at FROM video_progress WHERE user_id = ? AND video_id = ? FOR UPDATE", userID, video.ID).
+		Scan(&p.FurthestPosition, &p.WatchedSeconds, &p.CompletedAt)
+	if err != nil && err != sql.ErrNoRows {
+		return nil, err
+	}
+
+	p.Position = position
+	if position > p.FurthestPosition {
+		p.FurthestPosition = position
+	}
+	p.WatchedSeconds += watched
+	if p.CompletedAt == nil && video.Duration != nil && *video.Duration > 0 {
+		needed := int64(threshold * float64(*video.Duration))
+		if p.FurthestPosition >= needed && p.WatchedSeconds >= needed {
+			now := time.Now().Format("2006-01-02 15:04:05")
+			p.CompletedAt = &now
+		}
+	}
+
+	_, err = tx.Exec("INSERT INTO video_progress (`user_id`,`video_id`,`position`,`furthest_position`,`watched_seconds`,`completed_at`) VALUES (?,?,?,?,?,?) "+
+		"ON DUPLICATE KEY UPDATE `position` = VALUES(`position`), `furthest_position` = VALUES(`furthest_position`), `watched_seconds` = VALUES(`watched_seconds`), `completed_at` = VALUES(`completed_at`)",
+		p.UserID, p.VideoID, p.Position, p.FurthestPosition, p.WatchedSeconds, p.CompletedAt)
+	if err != nil {
+		return nil, err
+	}
+	return p, tx.Commit()
+}
+
+// IsComplete tells whether every video of the course is completed, a course
+// without videos has nothing left to do.
+func (cp *CourseProgress) IsComplete() bool {
+	return cp.CompletedVideos >= cp.TotalVideos
+}
+
+// ForCourse sums up the progress of the user over the course's published
+// online videos.
+func (vp *VideoProgress) ForCourse(userID int64, courseID int64) (*CourseProgress, error) {
+	course := &CourseProgress{CourseID: courseID, Videos: []*VideoProgress{}}
+
+	rows, err := vp.Env.DB.Query("SELECT v.id, p.position, p.furthest_position, p.watched_seconds, p.completed_at, p.updated_at FROM video v "+
+		"LEFT JOIN video_progress p ON p.video_id = v.id AND p.user_id = ? WHERE v.course_id = ? AND v.offline = 0 AND v.deleted_at IS NULL AND "+visibleSQL("v"), userID, courseID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var (
+			videoID   int64
+			position  *int64
+			furthest  *int64
+			watched   *int64
+			completed *string
+			updated   *string
+		)
+		if err := rows.Scan(&videoID, &position, &furthest, &watched, &completed, &updated); err != nil {
+			return nil, err
+		}
+		course.TotalVideos++
+		if position == nil {
+			continue
+		}
+		p := &VideoProgress{UserID: userID, VideoID: videoID, Position: *position, FurthestPosition: *furthest, WatchedSeconds: *watched, CompletedAt: completed, UpdatedAt: *updated}
+		if completed != nil {
+			course.CompletedVideos++
+		}
+		course.WatchedSeconds += p.WatchedSeconds
+		course.Videos = append(course.Videos, p)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if course.TotalVideos > 0 {
+		course.Percent = float64(course.CompletedVideos) * 100 / float64(course.TotalVideos)
+	}
+	return course, nil
+}
@@ -0,0 +1,89 @@
+package model
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+)
+
+const (
+	StatusDraft     = "draft"
+	StatusInReview  = "in_review"
+	StatusPublished = "published"
+	StatusArchived  = "archived"
+)
+
+var (
+	ErrInvalidTransition = errors.New("status change is not allowed")
+	ErrPublishAtStatus   = errors.New("publish_at can only be set when publishing")
+)
+
+// transitions lists the states every state may move to.
+var transitions = map[string][]string{
+	StatusDraft:     {StatusInReview},
+	StatusInReview:  {StatusDraft, StatusPublished},
+	StatusPublished: {StatusArchived},
+	StatusArchived:  {StatusDraft},
+}
+
+// Transition is a requested status change. PublishAt schedules a
+// publication, when it is empty content is published right away.
+type Transition struct {
+	Status    string     `json:"status"`
+	PublishAt *time.Time `json:"publish_at"`
+}
+
+func CanTransition(from string, to string) bool {
+	for _, s := range transitions[from] {
+		if s == to {
+			return true
+		}
+	}
+	return false
+}
+
+func isVisible(status string, publishAt *time.Time) bool {
+	return status == StatusPublished && publishAt != nil && !publishAt.After(time.Now())
+}
+
+// visibleSQL matches published rows whose publish_at has passed, so a
+// scheduled publication needs no job to go live.
+func visibleSQL(alias string) string {
+	if alias != "" {
+		alias += "."
+	}
+	return alias + "status = 'published' AND " + alias + "publish_at <= NOW()"
+}
+
+// changeStatus moves a course or video to a new status. table is never user
+// input.
+func changeStatus(db *sql.DB, table string, ID int64, t *Transition) error {
+	if t.PublishAt != nil && t.Status != StatusPublished {
+		return ErrPublishAtStatus
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var status string
+	err = tx.QueryRow("SELECT status FROM `"+table+"` WHERE id = ? FOR UPDATE", ID).Scan(&status)
+	if err != nil {
+		return err
+	}
+	if !CanTransition(status, t.Status) {
+		return ErrInvalidTransition
+	}
+
+	if t.Status == StatusPublished {
+		_, err = tx.Exec("UPDATE `"+table+"` SET status = ?, publish_at = COALESCE(?, NOW()) WHERE id = ?", t.Status, t.PublishAt, ID)
+	} else {
+		_, err = tx.Exec("UPDATE `"+table+"` SET status = ?, publish_at = NULL WHERE id = ?", t.Status, ID)
+	}
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
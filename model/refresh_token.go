@@ -0,0 +1,116 @@
+package model
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/arizanovj/courses/auth"
+	"github.com/arizanovj/courses/env"
+)
+
+var ErrInvalidRefreshToken = errors.New("invalid or expired refresh token")
+
+type execer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+}
+
+type RefreshToken struct {
+	ID        int64      `json:"id"`
+	UserID    int64      `json:"user_id"`
+	SessionID string     `json:"session_id"`
+	ExpiresAt time.Time  `json:"expires_at"`
+	RevokedAt *time.Time `json:"revoked_at"`
+	Token     string     `json:"-"`
+	Env       *env.Env   `json:"-"`
+}
+
+// Create issues a new refresh token for the session. The plain token is only
+// available on the returned struct, the database keeps its hash.
+func (rt *RefreshToken) Create(session *Session, ttl time.Duration) (*RefreshToken, error) {
+	return rt.insert(rt.Env.DB, session.UserID, session.ID, ttl)
+}
+
+func (rt *RefreshToken) insert(db execer, userID int64, sessionID string, ttl time.Duration) (*RefreshToken, error) {
+	token, err := auth.NewToken()
+	if err != nil {
+		return nil, err
+	}
+	expiresAt := time.Now().Add(ttl)
+	result, err := db.Exec("INSERT INTO refresh_token (`user_id`,`session_id`,`token_hash`,`expires_at`) VALUES (?,?,?,?) ", userID, sessionID, auth.HashToken(token), expiresAt)
+	if err != nil {
+		return nil, err
+	}
+	lastID, err := result.LastInsertId()
+	if err != nil {
+		return nil, err
+	}
+	return &RefreshToken{ID: lastID, UserID: userID, SessionID: sessionID, ExpiresAt: expiresAt, Token: token, Env: rt.Env}, nil
+}
+
+// Rotate exchanges a valid refresh token for a new one of the same session
+// and revokes the old one. Presenting an already rotated token is treated as
+// theft and revokes the whole session, one revoked by logging out is only
+// refused.
+func (rt *RefreshToken) Rotate(token string, ttl time.Duration) (*RefreshToken, error) {
+	tx, err := rt.Env.DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	current := &RefreshToken{Env: rt.Env}
+	var sessionRevokedAt *time.Time
+	var replacedBy *int64
+	err = tx.QueryRow("SELECT t.id, t.user_id, t.session_id, t.expires_at, t.revoked_at, t.replaced_by, s.revoked_at FROM refresh_token t JOIN session s ON s.id = t.session_id WHERE t.token_hash = ? FOR UPDATE", auth.HashToken(token)).
+		Scan(&current.ID, &current.UserID, &current.SessionID, &current.ExpiresAt, &current.RevokedAt, &replacedBy, &sessionRevokedAt)
+	if err == sql.ErrNoRows {
+		return nil, ErrInvalidRefreshToken
+	} else if err != nil {
+		return nil, err
+	}
+
+	if current.RevokedAt != nil && replacedBy != nil {
+		tx.Rollback()
+		session := &Session{Env: rt.Env}
+		if err := session.Revoke(current.UserID, current.SessionID); err != nil && err != ErrSessionNotFound {
+			return nil, err
+		}
+		return nil, ErrInvalidRefreshToken
+	}
+	if current.RevokedAt != nil || sessionRevokedAt != nil || current.ExpiresAt.Before(time.Now()) {
+		return nil, ErrInvalidRefreshToken
+	}
+
+	next, err := rt.insert(tx, current.UserID, current.SessionID, ttl)
+	if err != nil {
+		return nil, err
+	}
+	if _, err = tx.Exec("UPDATE refresh_token SET revoked_at = NOW(), replaced_by = ? WHERE id = ?", next.ID, current.ID); err != nil {
+		return nil, err
+	}
+	if _, err = tx.Exec("UPDATE session SET expires_at = ? WHERE id = ?", next.ExpiresAt, next.SessionID); err != nil {
+		return nil, err
+	}
+
+	return next, tx.Commit()
+}
+
+// Revoke ends the session the refresh token belongs to.
+func (rt *RefreshToken) Revoke(token string) error {
+	var userID int64
+	var sessionID string
+	err := rt.Env.DB.QueryRow("SELECT user_id, session_id FROM refresh_token WHERE token_hash = ? AND revoked_at IS NULL", auth.HashToken(token)).Scan(&userID, &sessionID)
+	if err == sql.ErrNoRows {
+		return ErrInvalidRefreshToken
+	} else if err != nil {
+		return err
+	}
+
+	session := &Session{Env: rt.Env}
+	err = session.Revoke(userID, sessionID)
+	if err == ErrSessionNotFound {
+		return ErrInvalidRefreshToken
+	}
+	return err
+}
@@ -0,0 +1,249 @@
+package model
+
+import (
+	"database/sql"
+	"errors"
+
+	"github.com/arizanovj/courses/env"
+	"github.com/go-ozzo/ozzo-validation"
+)
+
+var (
+	ErrSectionNotFound    = errors.New("there is no such section")
+	ErrSectionNotInCourse = errors.New("section does not belong to the course of the video")
+	ErrSyllabusMismatch   = errors.New("order must list every section and video of the course exactly once")
+)
+
+type Section struct {
+	ID          int64    `json:"id"`
+	CourseID    int64    `json:"course_id"`
+	Name        string   `json:"name"`
+	Description *string  `json:"description"`
+	Position    int      `json:"position"`
+	CreatedAt   string   `json:"created_at"`
+	UpdatedAt   string   `json:"updated_at"`
+	Videos      []*Video `json:"videos,omitempty"`
+	Env         *env.Env `json:"-"`
+}
+
+// Syllabus is the ordered outline of a course. Videos that are not assigned
+// to a section are listed after the sections.
+type Syllabus struct {
+	Sections []*Section `json:"sections"`
+	Videos   []*Video   `json:"videos"`
+}
+
+// SyllabusOrder is the complete new order of a course, as sent by the
+// reorder endpoint.
+type SyllabusOrder struct {
+	Sections []SectionOrder `json:"sections"`
+	Videos   []int64        `json:"videos"`
+}
+
+type SectionOrder struct {
+	ID     int64   `json:"id"`
+	Videos []int64 `json:"videos"`
+}
+
+func (s Section) Validate() error {
+	return validation.ValidateStruct(&s,
+		validation.Field(&s.Name, validation.Required, validation.Length(1, 255)),
+	)
+}
+
+func (s *Section) GetForCourse(courseID int64) ([]*Section, error) {
+	sections := []*Section{}
+	rows, err := s.Env.DB.Query("SELECT id, course_id, name, description, position, created_at, updated_at FROM section WHERE course_id = ? ORDER BY position, id", courseID)
+	if err != nil {
+		return sections, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		section := &Section{Env: s.Env}
+		if err := rows.Scan(&section.ID, &section.CourseID, &section.Name, &section.Description, &section.Position, &section.CreatedAt, &section.UpdatedAt); err != nil {
+			return sections, err
+		}
+		sections = append(sections, section)
+	}
+	return sections, rows.Err()
+}
+
+func (s *Section) GetByID(ID int64) (*Section, error) {
+	err := s.Env.DB.QueryRow("SELECT id, course_id, name, description, position, created_at, updated_at FROM section WHERE id = ?", ID).
+		Scan(&s.ID, &s.CourseID, &s.Name, &s.Description, &s.Position, &s.CreatedAt, &s.UpdatedAt)
+	if err == sql.ErrNoRows {
+		return &Section{}, ErrSectionNotFound
+	} else if err != nil {
+		return &Section{}, err
+	}
+	return s, nil
+}
+
+// Create appends the section to the end of the course.
+func (s *Section) Create() (int64, error) {
+	result, err := s.Env.DB.Exec("INSERT INTO section (`course_id`,`name`,`description`,`position`) "+
+		"SELECT ?, ?, ?, COALESCE(MAX(position) + 1, 0) FROM section WHERE course_id = ?",
+		&s.CourseID, &s.Name, &s.Description, &s.CourseID)
+	if err != nil {
+		return 0, err
+	}
+	return result.LastInsertId()
+}
+
+func (s *Section) Update() error {
+	result, err := s.Env.DB.Exec("UPDATE section SET `name` = ?, `description` = ? WHERE id = ?", &s.Name, &s.Description, &s.ID)
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		if _, err := s.GetByID(s.ID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Delete removes the section, its videos stay in the course unassigned.
+func (s *Section) Delete() error {
+	tx, err := s.Env.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err = tx.Exec("UPDATE video SET section_id = NULL WHERE section_id = ?", s.ID); err != nil {
+		return err
+	}
+	result, err := tx.Exec("DELETE FROM section WHERE id = ?", s.ID)
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrSectionNotFound
+	}
+	return tx.Commit()
+}
+
+// GetSyllabus returns the sections of the course with their videos in order.
+func (course *Course) GetSyllabus() (*Syllabus, error) {
+	section := &Section{Env: course.Env}
+	sections, err := section.GetForCourse(course.ID)
+	if err != nil {
+		return nil, err
+	}
+	syllabus := &Syllabus{Sections: sections, Videos: []*Video{}}
+	bySection := make(map[int64]*Section, len(sections))
+	for _, s := range sections {
+		s.Videos = []*Video{}
+		bySection[s.ID] = s
+	}
+
+	query := "SELECT id, name, description, cover, src, offline, public, course_id, section_id, position, duration, status, publish_at, created_at, updated_at FROM video WHERE course_id = ? AND deleted_at IS NULL"
+	if course.OnlyPublished {
+		query += " AND " + visibleSQL("")
+	}
+	rows, err := course.Env.DB.Query(query+" ORDER BY position, id", course.ID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		v := &Video{Env: course.Env}
+		if err := rows.Scan(&v.ID, &v.Name, &v.Description, &v.Cover, &v.Src, &v.Offline, &v.Public, &v.CourseID, &v.SectionID, &v.Position, &v.Duration, &v.Status, &v.PublishAt, &v.CreatedAt, &v.UpdatedAt); err != nil {
+			return nil, err
+		}
+		if v.SectionID != nil && bySection[*v.SectionID] != nil {
+			s := bySection[*v.SectionID]
+			s.Videos = append(s.Videos, v)
+		} else {
+			syllabus.Videos = append(syllabus.Videos, v)
+		}
+	}
+	return syllabus, rows.Err()
+}
+
+// Reorder applies a complete new order of sections and videos. Videos may
+// move between sections but not between courses.
+func (course *Course) Reorder(order *SyllabusOrder) error {
+	tx, err := course.Env.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	sections, err := lockIDs(tx, "SELECT id FROM section WHERE course_id = ? FOR UPDATE", course.ID)
+	if err != nil {
+		return err
+	}
+	videos, err := lockIDs(tx, "SELECT id FROM video WHERE course_id = ? AND deleted_at IS NULL FOR UPDATE", course.ID)
+	if err != nil {
+		return err
+	}
+
+	videoIDs := append([]int64{}, order.Videos...)
+	sectionIDs := make([]int64, len(order.Sections))
+	for i, s := range order.Sections {
+		sectionIDs[i] = s.ID
+		videoIDs = append(videoIDs, s.Videos...)
+	}
+	if !sameIDs(sections, sectionIDs) || !sameIDs(videos, videoIDs) {
+		return ErrSyllabusMismatch
+	}
+
+	for i, s := range order.Sections {
+		if _, err = tx.Exec("UPDATE section SET position = ? WHERE id = ?", i, s.ID); err != nil {
+			return err
+		}
+		for j, videoID := range s.Videos {
+			if _, err = tx.Exec("UPDATE video SET section_id = ?, position = ? WHERE id = ?", s.ID, j, videoID); err != nil {
+				return err
+			}
+		}
+	}
+	for j, videoID := range order.Videos {
+		if _, err = tx.Exec("UPDATE video SET section_id = NULL, position = ? WHERE id = ?", j, videoID); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func lockIDs(tx *sql.Tx, query string, args ...interface{}) (map[int64]bool, error) {
+	IDs := make(map[int64]bool)
+	rows, err := tx.Query(query, args...)
+	if err != nil {
+		return IDs, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var ID int64
+		if err := rows.Scan(&ID); err != nil {
+			return IDs, err
+		}
+		IDs[ID] = true
+	}
+	return IDs, rows.Err()
+}
+
+// sameIDs tells whether IDs lists every key of existing exactly once.
+func sameIDs(existing map[int64]bool, IDs []int64) bool {
+	if len(existing) != len(IDs) {
+		return false
+	}
+	seen := make(map[int64]bool, len(IDs))
+	for _, ID := range IDs {
+		if !existing[ID] || seen[ID] {
+			return false
+		}
+		seen[ID] = true
+	}
+	return true
+}
@@ -0,0 +1,124 @@
+package model
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/arizanovj/courses/auth"
+	"github.com/arizanovj/courses/env"
+)
+
+var ErrSessionNotFound = errors.New("there is no such session")
+
+// Session is one login of a user on one device. Its ID is the jti claim of
+// every access token issued for it, so revoking it invalidates those tokens
+// along with its refresh token.
+type Session struct {
+	ID         string    `json:"id"`
+	UserID     int64     `json:"user_id"`
+	UserAgent  string    `json:"user_agent"`
+	IP         string    `json:"ip"`
+	CreatedAt  string    `json:"created_at"`
+	LastSeenAt string    `json:"last_seen_at"`
+	ExpiresAt  time.Time `json:"expires_at"`
+	Current    bool      `json:"current"`
+	Env        *env.Env  `json:"-"`
+}
+
+func (s *Session) Create(userID int64, userAgent string, ip string, ttl time.Duration) (*Session, error) {
+	ID, err := auth.NewToken()
+	if err != nil {
+		return nil, err
+	}
+	if len(userAgent) > 255 {
+		userAgent = userAgent[:255]
+	}
+	session := &Session{ID: ID, UserID: userID, UserAgent: userAgent, IP: ip, ExpiresAt: time.Now().Add(ttl), Env: s.Env}
+	_, err = s.Env.DB.Exec("INSERT INTO session (`id`,`user_id`,`user_agent`,`ip`,`last_seen_at`,`expires_at`) VALUES (?,?,?,?,NOW(),?) ",
+		session.ID, session.UserID, session.UserAgent, session.IP, session.ExpiresAt)
+	if err != nil {
+		return nil, err
+	}
+	return session, nil
+}
+
+func (s *Session) GetForUser(userID int64) ([]*Session, error) {
+	sessions := []*Session{}
+	rows, err := s.Env.DB.Query("SELECT id, user_id, user_agent, ip, created_at, last_seen_at, expires_at FROM session WHERE user_id = ? AND revoked_at IS NULL AND expires_at > NOW() ORDER BY last_seen_at DESC", userID)
+	if err != nil {
+		return sessions, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		session := new(Session)
+		if err := rows.Scan(&session.ID, &session.UserID, &session.UserAgent, &session.IP, &session.CreatedAt, &session.LastSeenAt, &session.ExpiresAt); err != nil {
+			return sessions, err
+		}
+		sessions = append(sessions, session)
+	}
+	return sessions, rows.Err()
+}
+
+func (s *Session) Revoke(userID int64, ID string) error {
+	tx, err := s.Env.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec("UPDATE session SET revoked_at = NOW() WHERE id = ? AND user_id = ? AND revoked_at IS NULL", ID, userID)
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrSessionNotFound
+	}
+	if _, err = tx.Exec("UPDATE refresh_token SET revoked_at = NOW() WHERE session_id = ? AND revoked_at IS NULL", ID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (s *Session) RevokeAllForUser(userID int64) error {
+	return revokeSessionsForUser(s.Env.DB, userID)
+}
+
+func revokeSessionsForUser(db execer, userID int64) error {
+	if _, err := db.Exec("UPDATE session SET revoked_at = NOW() WHERE user_id = ? AND revoked_at IS NULL", userID); err != nil {
+		return err
+	}
+	_, err := db.Exec("UPDATE refresh_token SET revoked_at = NOW() WHERE user_id = ? AND revoked_at IS NULL", userID)
+	return err
+}
+
+// SessionStore lets the auth middleware reject tokens of revoked sessions.
+type SessionStore struct {
+	Env *env.Env
+}
+
+func (s *SessionStore) SessionActive(ID string) (bool, error) {
+	var expiresAt time.Time
+	var revokedAt *time.Time
+	var lastSeen time.Time
+	err := s.Env.DB.QueryRow("SELECT expires_at, revoked_at, last_seen_at FROM session WHERE id = ?", ID).Scan(&expiresAt, &revokedAt, &lastSeen)
+	if err == sql.ErrNoRows {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	if revokedAt != nil || expiresAt.Before(time.Now()) {
+		return false, nil
+	}
+	// activity is only tracked to the minute to spare a write per request
+	if time.Since(lastSeen) > time.Minute {
+		if _, err := s.Env.DB.Exec("UPDATE session SET last_seen_at = NOW() WHERE id = ?", ID); err != nil {
+			return false, err
+		}
+	}
+	return true, nil
+}
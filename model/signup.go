@@ -0,0 +1,50 @@
+package model
+
+import (
+	"errors"
+
+	"github.com/arizanovj/courses/env"
+	"github.com/go-ozzo/ozzo-validation"
+	"github.com/go-ozzo/ozzo-validation/is"
+	"github.com/go-sql-driver/mysql"
+	"golang.org/x/crypto/bcrypt"
+)
+
+var ErrEmailTaken = errors.New("an account with this email already exists")
+
+// mysqlDuplicateKey is the MySQL error number of a unique key violation.
+const mysqlDuplicateKey = 1062
+
+type Signup struct {
+	Email     string   `json:"email"`
+	FirstName string   `json:"first_name"`
+	LastName  string   `json:"last_name"`
+	Password  string   `json:"password"`
+	Env       *env.Env `json:"-"`
+}
+
+func (s Signup) Validate() error {
+	return validation.ValidateStruct(&s,
+		validation.Field(&s.Email, validation.Required, validation.Length(5, 50), is.Email),
+		validation.Field(&s.FirstName, validation.Required, validation.Length(1, 50)),
+		validation.Field(&s.LastName, validation.Required, validation.Length(1, 50)),
+		validation.Field(&s.Password, validation.Required, validation.Length(8, 20)),
+	)
+}
+
+// Register creates a non admin user whose email is not verified yet. The
+// unique key on email tells a taken one apart, concurrent signups included.
+func (s *Signup) Register() (int64, error) {
+	bytes, err := bcrypt.GenerateFromPassword([]byte(s.Password), 14)
+	if err != nil {
+		return 0, err
+	}
+	result, err := s.Env.DB.Exec("INSERT INTO user (`email`,`first_name`,`last_name`,`password_hash`,`is_admin`) VALUES (?,?,?,?,0) ", &s.Email, &s.FirstName, &s.LastName, bytes)
+	if mysqlErr, ok := err.(*mysql.MySQLError); ok && mysqlErr.Number == mysqlDuplicateKey {
+		return 0, ErrEmailTaken
+	} else if err != nil {
+		return 0, err
+	}
+
+	return result.LastInsertId()
+}
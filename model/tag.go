@@ -0,0 +1,155 @@
+package model
+
+import (
+	"database/sql"
+	"errors"
+	"strings"
+
+	"github.com/arizanovj/courses/env"
+	"github.com/go-ozzo/ozzo-validation"
+)
+
+var (
+	ErrTagNotFound = errors.New("there is no such tag")
+	ErrTagTaken    = errors.New("a tag with this name already exists")
+)
+
+type Tag struct {
+	ID      int64    `json:"id"`
+	Name    string   `json:"name"`
+	Courses int      `json:"courses"`
+	Env     *env.Env `json:"-"`
+}
+
+func (t Tag) Validate() error {
+	return validation.ValidateStruct(&t,
+		validation.Field(&t.Name, validation.Required, validation.Length(1, 50)),
+	)
+}
+
+// GetAll lists the tags with the number of courses using them.
+func (t *Tag) GetAll() ([]*Tag, error) {
+	tags := []*Tag{}
+	rows, err := t.Env.DB.Query("SELECT t.id, t.name, COUNT(ct.course_id) FROM tag t LEFT JOIN course_tag ct ON ct.tag_id = t.id GROUP BY t.id, t.name ORDER BY t.name")
+	if err != nil {
+		return tags, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		tag := &Tag{Env: t.Env}
+		if err := rows.Scan(&tag.ID, &tag.Name, &tag.Courses); err != nil {
+			return tags, err
+		}
+		tags = append(tags, tag)
+	}
+	return tags, rows.Err()
+}
+
+func (t *Tag) Create() (int64, error) {
+	t.Name = normalizeTag(t.Name)
+	if err := t.checkName(); err != nil {
+		return 0, err
+	}
+	result, err := t.Env.DB.Exec("INSERT INTO tag (`name`) VALUES (?)", t.Name)
+	if err != nil {
+		return 0, err
+	}
+	return result.LastInsertId()
+}
+
+// Update renames the tag on every course at once.
+func (t *Tag) Update() error {
+	t.Name = normalizeTag(t.Name)
+	if err := t.checkName(); err != nil {
+		return err
+	}
+	result, err := t.Env.DB.Exec("UPDATE tag SET `name` = ? WHERE id = ?", t.Name, t.ID)
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrTagNotFound
+	}
+	return nil
+}
+
+func (t *Tag) Delete() error {
+	result, err := t.Env.DB.Exec("DELETE FROM tag WHERE id = ?", t.ID)
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrTagNotFound
+	}
+	return nil
+}
+
+func (t *Tag) checkName() error {
+	var ID int64
+	err := t.Env.DB.QueryRow("SELECT id FROM tag WHERE name = ? AND id <> ?", t.Name, t.ID).Scan(&ID)
+	if err == sql.ErrNoRows {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	return ErrTagTaken
+}
+
+func normalizeTag(name string) string {
+	return strings.ToLower(strings.TrimSpace(name))
+}
+
+// setCourseTags replaces the tags of a course, creating tags that don't
+// exist yet.
+func setCourseTags(tx *sql.Tx, courseID int64, names []string) error {
+	if _, err := tx.Exec("DELETE FROM course_tag WHERE course_id = ?", courseID); err != nil {
+		return err
+	}
+	for _, name := range names {
+		name = normalizeTag(name)
+		if name == "" {
+			continue
+		}
+		if _, err := tx.Exec("INSERT IGNORE INTO tag (`name`) VALUES (?)", name); err != nil {
+			return err
+		}
+		if _, err := tx.Exec("INSERT IGNORE INTO course_tag (`course_id`,`tag_id`) SELECT ?, id FROM tag WHERE name = ?", courseID, name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// courseTags loads the tag names of the given courses.
+func courseTags(db *sql.DB, IDs []int64) (map[int64][]string, error) {
+	tags := make(map[int64][]string)
+	if len(IDs) == 0 {
+		return tags, nil
+	}
+	in := make([]interface{}, len(IDs))
+	for i, ID := range IDs {
+		in[i] = ID
+	}
+	rows, err := db.Query("SELECT ct.course_id, t.name FROM course_tag ct JOIN tag t ON t.id = ct.tag_id WHERE ct.course_id IN (?"+strings.Repeat(",?", len(IDs)-1)+") ORDER BY t.name", in...)
+	if err != nil {
+		return tags, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var courseID int64
+		var name string
+		if err := rows.Scan(&courseID, &name); err != nil {
+			return tags, err
+		}
+		tags[courseID] = append(tags[courseID], name)
+	}
+	return tags, rows.Err()
+}
@@ -0,0 +1,161 @@
+package model
+
+import (
+	"database/sql"
+	"log"
+	"time"
+
+	"github.com/arizanovj/courses/env"
+	"github.com/arizanovj/courses/storage"
+	goqu "gopkg.in/doug-martin/goqu.v4"
+)
+
+// trashed selects either the live or the trashed rows of a listing.
+func trashed(trash bool) goqu.Expression {
+	if trash {
+		return goqu.I("deleted_at").IsNotNull()
+	}
+	return goqu.I("deleted_at").IsNull()
+}
+
+// softDelete moves a row to the trash. table is never user input.
+func softDelete(db execer, table string, ID int64) error {
+	result, err := db.Exec("UPDATE `"+table+"` SET deleted_at = NOW() WHERE id = ? AND deleted_at IS NULL", ID)
+	if err != nil {
+		return err
+	}
+	return expectAffected(result)
+}
+
+// restore takes a row back out of the trash. table is never user input.
+func restore(db execer, table string, ID int64) error {
+	result, err := db.Exec("UPDATE `"+table+"` SET deleted_at = NULL WHERE id = ? AND deleted_at IS NOT NULL", ID)
+	if err != nil {
+		return err
+	}
+	return expectAffected(result)
+}
+
+func expectAffected(result sql.Result) error {
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// Purger permanently removes rows that have been in the trash for longer
+// than Retention, together with their files. Videos of purged courses go
+// with them.
+type Purger struct {
+	Retention time.Duration
+	Env       *env.Env
+}
+
+type PurgeResult struct {
+	Courses int
+	Videos  int
+	Users   int
+}
+
+func (p *Purger) Purge() (*PurgeResult, error) {
+	result := &PurgeResult{}
+	before := time.Now().Add(-p.Retention)
+
+	var files []string
+	err := p.purgeTx(func(tx *sql.Tx) error {
+		rows, err := tx.Query("SELECT v.id, v.cover, v.src FROM video v LEFT JOIN course c ON c.id = v.course_id "+
+			"WHERE v.deleted_at < ? OR c.deleted_at < ? FOR UPDATE", before, before)
+		if err != nil {
+			return err
+		}
+		var IDs []interface{}
+		for rows.Next() {
+			var ID int64
+			var cover, src *string
+			if err := rows.Scan(&ID, &cover, &src); err != nil {
+				rows.Close()
+				return err
+			}
+			IDs = append(IDs, ID)
+			if cover != nil {
+				files = append(files, StorageKey(p.Env.ImageDir, *cover))
+			}
+			if src != nil {
+				files = append(files, StorageKey(p.Env.VideoDir, *src))
+			}
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+		for _, ID := range IDs {
+			if _, err := tx.Exec("DELETE FROM video WHERE id = ?", ID); err != nil {
+				return err
+			}
+		}
+		result.Videos = len(IDs)
+
+		rows, err = tx.Query("SELECT id, cover FROM course WHERE deleted_at < ? FOR UPDATE", before)
+		if err != nil {
+			return err
+		}
+		IDs = nil
+		for rows.Next() {
+			var ID int64
+			var cover *string
+			if err := rows.Scan(&ID, &cover); err != nil {
+				rows.Close()
+				return err
+			}
+			IDs = append(IDs, ID)
+			if cover != nil {
+				files = append(files, StorageKey(p.Env.ImageDir, *cover))
+			}
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+		for _, ID := range IDs {
+			if _, err := tx.Exec("DELETE FROM course WHERE id = ?", ID); err != nil {
+				return err
+			}
+		}
+		result.Courses = len(IDs)
+
+		users, err := tx.Exec("DELETE FROM `user` WHERE deleted_at < ?", before)
+		if err != nil {
+			return err
+		}
+		affected, err := users.RowsAffected()
+		result.Users = int(affected)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// files go only once the rows are gone, a failed purge is simply retried
+	for _, file := range files {
+		if err := p.Env.Storage.Delete(file); err != nil && err != storage.ErrNotFound {
+			log.Printf("purge: removing %s: %s", file, err)
+		}
+	}
+	return result, nil
+}
+
+func (p *Purger) purgeTx(fn func(tx *sql.Tx) error) error {
+	tx, err := p.Env.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if err := fn(tx); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
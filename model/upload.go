@@ -0,0 +1,270 @@
+package model
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/arizanovj/courses/env"
+)
+
+var (
+	ErrUploadNotFound = errors.New("there is no such upload")
+	ErrUploadOffset   = errors.New("upload offset doesn't match the bytes received so far")
+)
+
+// uploadsWriting holds the uploads a chunk is being written to. The files
+// are on the local disk of the process that received the upload, so a lock
+// in it is enough to keep two chunks from being written over each other.
+var uploadsWriting = struct {
+	sync.Mutex
+	IDs map[string]bool
+}{IDs: make(map[string]bool)}
+
+// lockUpload marks the upload as being written to, it returns false when
+// another request is writing to it.
+func lockUpload(ID string) bool {
+	uploadsWriting.Lock()
+	defer uploadsWriting.Unlock()
+	if uploadsWriting.IDs[ID] {
+		return false
+	}
+	uploadsWriting.IDs[ID] = true
+	return true
+}
+
+func unlockUpload(ID string) {
+	uploadsWriting.Lock()
+	delete(uploadsWriting.IDs, ID)
+	uploadsWriting.Unlock()
+}
+
+// Upload is a resumable upload of the file of a video. The bytes received
+// are appended to a file in Env.UploadDir, on the local disk whatever the
+// storage, once all Length of them arrived the file is stored in
+// Env.VideoDir and becomes the video's src.
+type Upload struct {
+	ID        string    `json:"id"`
+	VideoID   int64     `json:"video_id"`
+	UserID    int64     `json:"user_id"`
+	Length    int64     `json:"length"`
+	Offset    int64     `json:"offset"`
+	Extension string    `json:"extension"`
+	ExpiresAt time.Time `json:"expires_at"`
+	CreatedAt time.Time `json:"created_at"`
+	// Expiry is how long an upload is kept after its last chunk.
+	Expiry time.Duration `json:"-"`
+	// Types are the MIME types the complete file may be, with the largest
+	// size allowed for each, see CheckFileType.
+	Types map[string]int64 `json:"-"`
+	Env   *env.Env         `json:"-"`
+}
+
+func (u *Upload) Create() error {
+	ID := make([]byte, 16)
+	if _, err := rand.Read(ID); err != nil {
+		return err
+	}
+	u.ID = hex.EncodeToString(ID)
+
+	file, err := os.Create(u.path())
+	if err != nil {
+		return err
+	}
+	file.Close()
+
+	_, err = u.Env.DB.Exec("INSERT INTO upload (`id`,`video_id`,`user_id`,`length`,`offset`,`extension`,`expires_at`) VALUES (?,?,?,?,0,?,DATE_ADD(NOW(), INTERVAL ? SECOND))",
+		u.ID, u.VideoID, u.UserID, u.Length, u.Extension, int64(u.Expiry.Seconds()))
+	if err != nil {
+		os.Remove(u.path())
+	}
+	return err
+}
+
+func (u *Upload) GetByID(ID string) (*Upload, error) {
+	err := u.Env.DB.QueryRow("SELECT id, video_id, user_id, `length`, `offset`, extension, expires_at, created_at FROM upload WHERE id = ? AND expires_at > NOW()", ID).
+		Scan(&u.ID, &u.VideoID, &u.UserID, &u.Length, &u.Offset, &u.Extension, &u.ExpiresAt, &u.CreatedAt)
+	if err == sql.ErrNoRows {
+		return &Upload{}, ErrUploadNotFound
+	} else if err != nil {
+		return &Upload{}, err
+	}
+	return u, nil
+}
+
+// Append writes the chunk in body at offset, which has to be the number of
+// bytes received so far. Whatever arrived is kept even when reading body
+// fails, the client resumes from the new offset. The upload is completed
+// once the last byte is written. A chunk arriving while another one is
+// written is refused with ErrUploadOffset.
+func (u *Upload) Append(offset int64, body io.Reader) error {
+	if !lockUpload(u.ID) {
+		return ErrUploadOffset
+	}
+	defer unlockUpload(u.ID)
+
+	// no row is locked while the chunk arrives, which may take minutes, the
+	// offset is only moved if no other request moved it meanwhile
+	err := u.Env.DB.QueryRow("SELECT `offset`, `length` FROM upload WHERE id = ? AND expires_at > NOW()", u.ID).Scan(&u.Offset, &u.Length)
+	if err == sql.ErrNoRows {
+		return ErrUploadNotFound
+	} else if err != nil {
+		return err
+	}
+	if offset != u.Offset {
+		return ErrUploadOffset
+	}
+
+	file, err := os.OpenFile(u.path(), os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := file.Seek(offset, io.SeekStart); err != nil {
+		file.Close()
+		return err
+	}
+	written, copyErr := io.Copy(file, io.LimitReader(body, u.Length-offset))
+	if err := file.Close(); err != nil && copyErr == nil {
+		copyErr = err
+	}
+
+	// an empty chunk changes nothing, MySQL would count no affected rows
+	if written > 0 {
+		result, err := u.Env.DB.Exec("UPDATE upload SET `offset` = ?, `expires_at` = DATE_ADD(NOW(), INTERVAL ? SECOND) WHERE id = ? AND `offset` = ? AND expires_at > NOW()",
+			offset+written, int64(u.Expiry.Seconds()), u.ID, offset)
+		if err != nil {
+			return err
+		}
+		affected, err := result.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if affected == 0 {
+			return ErrUploadOffset
+		}
+		u.Offset = offset + written
+	}
+	if copyErr != nil {
+		return copyErr
+	}
+
+	if u.Offset == u.Length {
+		return u.complete()
+	}
+	return nil
+}
+
+// complete checks what the file is, stores it next to the other videos and
+// attaches it to the video in place of the previous one. An upload of the
+// wrong type is dropped, otherwise the bytes received are kept until then
+// and a failed completion is retried by the next PATCH.
+func (u *Upload) complete() error {
+	video := &Video{Env: u.Env}
+	video, err := video.GetByID(u.VideoID)
+	if err == sql.ErrNoRows {
+		u.Terminate()
+		return ErrUploadNotFound
+	} else if err != nil {
+		return err
+	}
+
+	file, err := os.Open(u.path())
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	mime, err := CheckFileType(file, u.Length, u.Types)
+	if _, tooLarge := err.(*FileTooLargeError); tooLarge || err == ErrFileType {
+		u.Terminate()
+		return err
+	} else if err != nil {
+		return err
+	}
+
+	name, err := newFileName("video_src_", FileExtension(mime))
+	if err != nil {
+		return err
+	}
+	err = u.Env.Storage.Put(StorageKey(u.Env.VideoDir, name), file, u.Length, mime)
+	if err != nil {
+		return err
+	}
+
+	previous := video.Src
+	video.Src = &name
+	if err := video.UpdateSrc(); err != nil {
+		u.Env.Storage.Delete(StorageKey(u.Env.VideoDir, name))
+		return err
+	}
+	if previous != nil {
+		u.Env.Storage.Delete(StorageKey(u.Env.VideoDir, *previous))
+	}
+	if _, err := u.Env.DB.Exec("DELETE FROM upload WHERE id = ?", u.ID); err != nil {
+		return err
+	}
+	os.Remove(u.path())
+	return nil
+}
+
+// Terminate drops the upload and the bytes received so far.
+func (u *Upload) Terminate() error {
+	result, err := u.Env.DB.Exec("DELETE FROM upload WHERE id = ?", u.ID)
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrUploadNotFound
+	}
+	os.Remove(u.path())
+	return nil
+}
+
+// Sweep removes the uploads that expired, returning how many there were.
+func (u *Upload) Sweep() (int, error) {
+	rows, err := u.Env.DB.Query("SELECT id FROM upload WHERE expires_at <= NOW()")
+	if err != nil {
+		return 0, err
+	}
+	IDs := []string{}
+	for rows.Next() {
+		var ID string
+		if err := rows.Scan(&ID); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		IDs = append(IDs, ID)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	swept := 0
+	for _, ID := range IDs {
+		// a chunk may have arrived since, it moves expires_at forward
+		result, err := u.Env.DB.Exec("DELETE FROM upload WHERE id = ? AND expires_at <= NOW()", ID)
+		if err != nil {
+			return swept, err
+		}
+		if affected, _ := result.RowsAffected(); affected == 0 {
+			continue
+		}
+		expired := &Upload{ID: ID, Env: u.Env}
+		os.Remove(expired.path())
+		swept++
+	}
+	return swept, nil
+}
+
+func (u *Upload) path() string {
+	return u.Env.BaseDir + u.Env.UploadDir + u.ID
+}
@@ -4,7 +4,9 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
+	"time"
 
+	"github.com/arizanovj/courses/auth"
 	"github.com/arizanovj/courses/env"
 
 	"github.com/arizanovj/courses/libs"
@@ -14,17 +16,23 @@ import (
 )
 
 type User struct {
-	ID           int64    `json:"id" filter:"id,number"`
-	Email        string   `json:"email" filter:"email,string"`
-	FirstName    string   `json:"first_name" filter:"first_name,string"`
-	LastName     string   `json:"last_name" filter:"last_name,string"`
-	PasswordHash string   `json:"-" filter:"-"`
-	Password     string   `json:"password" filter:"-"`
-	IsAdmin      *bool    `json:"is_admin" filter:"is_admin,string"`
-	CreatedAt    string   `json:"created_at" filter:"created_at,string"`
-	UpdatedAt    string   `json:"updated_at" filter:"updated_at,string"`
-	DB           *sql.DB  `json:"-"`
-	Env          *env.Env `json:"-"`
+	ID           int64      `json:"id" filter:"id,number"`
+	Email        string     `json:"email" filter:"email,string"`
+	FirstName    string     `json:"first_name" filter:"first_name,string"`
+	LastName     string     `json:"last_name" filter:"last_name,string"`
+	PasswordHash string     `json:"-" filter:"-"`
+	Password     string     `json:"password" filter:"-"`
+	IsAdmin      *bool      `json:"is_admin" filter:"is_admin,string"`
+	IsInstructor *bool      `json:"is_instructor" filter:"is_instructor,string"`
+	VerifiedAt   *string    `json:"email_verified_at" filter:"-"`
+	MFAEnabledAt *string    `json:"mfa_enabled_at" filter:"-"`
+	CreatedAt    string     `json:"created_at" filter:"created_at,string"`
+	UpdatedAt    string     `json:"updated_at" filter:"updated_at,string"`
+	DeletedAt    *time.Time `json:"deleted_at,omitempty" filter:"deleted_at,date"`
+	// Trash lists trashed users instead of live ones.
+	Trash bool     `json:"-"`
+	DB    *sql.DB  `json:"-"`
+	Env   *env.Env `json:"-"`
 }
 
 func (user *User) Get(p *pagination.Paginator, f *filter.Filter) ([]*User, error) {
@@ -36,8 +44,10 @@ func (user *User) Get(p *pagination.Paginator, f *filter.Filter) ([]*User, error
 		goqu.I("first_name"),
 		goqu.I("last_name"),
 		goqu.I("is_admin"),
+		goqu.I("is_instructor"),
 		goqu.I("created_at"),
-		goqu.I("updated_at")).Order(goqu.I("created_at").Desc()).Prepared(true)
+		goqu.I("updated_at"),
+		goqu.I("deleted_at")).Where(trashed(user.Trash)).Order(goqu.I("created_at").Desc()).Prepared(true)
 
 	p.PK = "id"
 	query = f.Filterize(query)
@@ -49,7 +59,7 @@ func (user *User) Get(p *pagination.Paginator, f *filter.Filter) ([]*User, error
 	defer rows.Close()
 	for rows.Next() {
 		u := new(User)
-		if err := rows.Scan(&u.ID, &u.Email, &u.FirstName, &u.LastName, &u.IsAdmin, &u.CreatedAt, &u.UpdatedAt); err != nil {
+		if err := rows.Scan(&u.ID, &u.Email, &u.FirstName, &u.LastName, &u.IsAdmin, &u.IsInstructor, &u.CreatedAt, &u.UpdatedAt, &u.DeletedAt); err != nil {
 			fmt.Printf("%+v\n", err)
 		}
 		users = append(users, u)
@@ -63,11 +73,11 @@ func (user *User) Get(p *pagination.Paginator, f *filter.Filter) ([]*User, error
 }
 
 func (user *User) FindByEmail(email string) (*User, error) {
-	err := user.DB.QueryRow("SELECT id, email as Email, password_hash FROM `user` WHERE email = ?", email).Scan(&user.ID, &user.Email, &user.PasswordHash)
+	err := user.DB.QueryRow("SELECT id, email as Email, password_hash, is_admin, email_verified_at, mfa_enabled_at FROM `user` WHERE email = ? AND deleted_at IS NULL", email).Scan(&user.ID, &user.Email, &user.PasswordHash, &user.IsAdmin, &user.VerifiedAt, &user.MFAEnabledAt)
 	if err == nil {
 		return user, nil
 	} else if err == sql.ErrNoRows {
-		return new(User), errors.New("there is no user with such email")
+		return new(User), ErrUserNotFound
 	}
 	return new(User), err
 }
@@ -78,13 +88,9 @@ func (user *User) Create() (int64, error) {
 	if err != nil {
 		return 0, err
 	}
-	var isAdmin int
-	if *user.IsAdmin == true {
-		isAdmin = 1
-	} else {
-		isAdmin = 0
-	}
-	result, err := user.Env.DB.Exec("INSERT INTO user (`email`,`first_name`,`last_name`,`password_hash`,`is_admin`) VALUES (?,?,?,?,?) ", &user.Email, &user.FirstName, &user.LastName, bytes, isAdmin)
+	isAdmin := user.IsAdmin != nil && *user.IsAdmin
+	isInstructor := user.IsInstructor != nil && *user.IsInstructor
+	result, err := user.Env.DB.Exec("INSERT INTO user (`email`,`first_name`,`last_name`,`password_hash`,`is_admin`,`is_instructor`,`email_verified_at`) VALUES (?,?,?,?,?,?,NOW()) ", &user.Email, &user.FirstName, &user.LastName, bytes, isAdmin, isInstructor)
 
 	if err != nil {
 		return 0, err
@@ -98,52 +104,134 @@ func (user *User) Create() (int64, error) {
 
 	return lastID, nil
 }
+
+// Update saves the user, leaving the admin flag as it is when IsAdmin is
+// nil. Tokens carry the flag, so changing it ends the user's sessions and
+// they have to log in again.
 func (user *User) Update() error {
+	tx, err := user.Env.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var wasAdmin bool
+	if err := tx.QueryRow("SELECT is_admin FROM user WHERE id = ? FOR UPDATE", &user.ID).Scan(&wasAdmin); err != nil {
+		return err
+	}
 
 	var query string
 	if user.Password != "" {
-		query = "UPDATE user SET `first_name` = ?, `last_name` = ?, is_admin = ?, password_hash = ?  WHERE id=?"
+		query = "UPDATE user SET `first_name` = ?, `last_name` = ?, is_admin = ?, is_instructor = COALESCE(?, is_instructor), password_hash = ?  WHERE id=?"
 	} else {
-		query = "UPDATE user SET `first_name` = ?, `last_name` = ?, is_admin = ?  WHERE id=?"
+		query = "UPDATE user SET `first_name` = ?, `last_name` = ?, is_admin = ?, is_instructor = COALESCE(?, is_instructor)  WHERE id=?"
 	}
-	sql, err := user.Env.DB.Prepare(query)
+	sql, err := tx.Prepare(query)
 	if err != nil {
 		return err
 	}
-	var isAdmin int
-	if *user.IsAdmin == true {
-		isAdmin = 1
-	} else {
-		isAdmin = 0
+	defer sql.Close()
+	isAdmin := wasAdmin
+	if user.IsAdmin != nil {
+		isAdmin = *user.IsAdmin
 	}
 
 	if user.Password != "" {
 		bytes, _ := bcrypt.GenerateFromPassword([]byte(user.Password), 14)
-		_, err = sql.Exec(&user.FirstName, &user.LastName, isAdmin, bytes, &user.ID)
+		_, err = sql.Exec(&user.FirstName, &user.LastName, isAdmin, user.IsInstructor, bytes, &user.ID)
 	} else {
-		_, err = sql.Exec(&user.FirstName, &user.LastName, isAdmin, &user.ID)
+		_, err = sql.Exec(&user.FirstName, &user.LastName, isAdmin, user.IsInstructor, &user.ID)
+	}
+	if err != nil {
+		return err
 	}
 
-	return err
+	if wasAdmin != isAdmin {
+		if err := revokeSessionsForUser(tx, user.ID); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
 }
 func (user *User) GetByID(ID int64) (*User, error) {
 
-	err := user.Env.DB.QueryRow("SELECT id, first_name, last_name, email, is_admin, created_at,updated_at FROM `user` where id = ? ", ID).Scan(&user.ID, &user.FirstName, &user.LastName, &user.Email, &user.IsAdmin, &user.CreatedAt, &user.UpdatedAt)
+	err := user.Env.DB.QueryRow("SELECT id, first_name, last_name, email, is_admin, is_instructor, email_verified_at, mfa_enabled_at, created_at,updated_at FROM `user` where id = ? AND deleted_at IS NULL", ID).Scan(&user.ID, &user.FirstName, &user.LastName, &user.Email, &user.IsAdmin, &user.IsInstructor, &user.VerifiedAt, &user.MFAEnabledAt, &user.CreatedAt, &user.UpdatedAt)
 	if err != nil {
 		return &User{}, err
 	}
 	return user, nil
 }
 
+// Delete moves the user to the trash and ends their sessions, Purger
+// removes the account for good.
 func (user *User) Delete() error {
-	sql, err := user.Env.DB.Prepare("DELETE FROM user WHERE id=?")
+	tx, err := user.Env.DB.Begin()
 	if err != nil {
 		return err
 	}
-	_, err = sql.Exec(&user.ID)
+	defer tx.Rollback()
+
+	if err = softDelete(tx, "user", user.ID); err != nil {
+		return err
+	}
+	if err = revokeSessionsForUser(tx, user.ID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (user *User) Restore() error {
+	return restore(user.Env.DB, "user", user.ID)
+}
+
+func (user *User) MarkEmailVerified(db execer) error {
+	_, err := db.Exec("UPDATE user SET email_verified_at = NOW() WHERE id = ? AND email_verified_at IS NULL", &user.ID)
 	return err
 }
 
 func (user *User) ValidatePassword(password string) error {
 	return bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(password))
 }
+
+func (user *User) Identity() *auth.Identity {
+	return &auth.Identity{
+		ID:      user.ID,
+		Email:   user.Email,
+		IsAdmin: user.IsAdmin != nil && *user.IsAdmin,
+	}
+}
+
+func (user *User) GetByIDs(IDs []int64) (map[int64]*User, error) {
+	users := make(map[int64]*User)
+	if len(IDs) == 0 {
+		return users, nil
+	}
+	in := make([]interface{}, len(IDs))
+	for i, ID := range IDs {
+		in[i] = ID
+	}
+
+	query := user.Env.QB.From(goqu.I("user")).Select(
+		goqu.I("id"),
+		goqu.I("email"),
+		goqu.I("first_name"),
+		goqu.I("last_name"),
+		goqu.I("is_admin"),
+		goqu.I("created_at"),
+		goqu.I("updated_at")).Where(goqu.I("id").In(in...), goqu.I("deleted_at").IsNull()).Prepared(true)
+	sqlstring, args, _ := query.ToSql()
+
+	rows, err := user.Env.DB.Query(sqlstring, args...)
+	if err != nil {
+		return users, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		u := new(User)
+		if err := rows.Scan(&u.ID, &u.Email, &u.FirstName, &u.LastName, &u.IsAdmin, &u.CreatedAt, &u.UpdatedAt); err != nil {
+			return users, err
+		}
+		users[u.ID] = u
+	}
+	return users, rows.Err()
+}
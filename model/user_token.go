@@ -0,0 +1,82 @@
+package model
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/arizanovj/courses/auth"
+	"github.com/arizanovj/courses/env"
+)
+
+const (
+	TokenEmailVerification = "email_verification"
+	TokenPasswordReset     = "password_reset"
+)
+
+var ErrInvalidUserToken = errors.New("invalid or expired token")
+
+// UserToken is a hashed, single use token emailed to a user.
+type UserToken struct {
+	ID        int64
+	UserID    int64
+	Purpose   string
+	ExpiresAt time.Time
+	UsedAt    *time.Time
+	Token     string
+	Env       *env.Env
+}
+
+func (ut *UserToken) Create(userID int64, purpose string, ttl time.Duration) (*UserToken, error) {
+	token, err := auth.NewToken()
+	if err != nil {
+		return nil, err
+	}
+	expiresAt := time.Now().Add(ttl)
+	result, err := ut.Env.DB.Exec("INSERT INTO user_token (`user_id`,`purpose`,`token_hash`,`expires_at`) VALUES (?,?,?,?) ", userID, purpose, auth.HashToken(token), expiresAt)
+	if err != nil {
+		return nil, err
+	}
+	lastID, err := result.LastInsertId()
+	if err != nil {
+		return nil, err
+	}
+	return &UserToken{ID: lastID, UserID: userID, Purpose: purpose, ExpiresAt: expiresAt, Token: token, Env: ut.Env}, nil
+}
+
+// Consume marks the token as used and returns it. The callback runs in the
+// same transaction so the token is only spent if fn succeeds.
+func (ut *UserToken) Consume(token string, purpose string, fn func(tx *sql.Tx, t *UserToken) error) (*UserToken, error) {
+	tx, err := ut.Env.DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	t := &UserToken{Purpose: purpose, Env: ut.Env}
+	err = tx.QueryRow("SELECT id, user_id, expires_at, used_at FROM user_token WHERE token_hash = ? AND purpose = ? FOR UPDATE", auth.HashToken(token), purpose).Scan(&t.ID, &t.UserID, &t.ExpiresAt, &t.UsedAt)
+	if err == sql.ErrNoRows {
+		return nil, ErrInvalidUserToken
+	} else if err != nil {
+		return nil, err
+	}
+	if t.UsedAt != nil || t.ExpiresAt.Before(time.Now()) {
+		return nil, ErrInvalidUserToken
+	}
+
+	if _, err = tx.Exec("UPDATE user_token SET used_at = NOW() WHERE id = ?", t.ID); err != nil {
+		return nil, err
+	}
+	if fn != nil {
+		if err = fn(tx, t); err != nil {
+			return nil, err
+		}
+	}
+	return t, tx.Commit()
+}
+
+// Invalidate spends every outstanding token of the given purpose for the user.
+func (ut *UserToken) Invalidate(userID int64, purpose string) error {
+	_, err := ut.Env.DB.Exec("UPDATE user_token SET used_at = NOW() WHERE user_id = ? AND purpose = ? AND used_at IS NULL", userID, purpose)
+	return err
+}
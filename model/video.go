@@ -4,6 +4,7 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
+	"time"
 
 	"github.com/arizanovj/courses/env"
 	pagination "github.com/arizanovj/courses/libs"
@@ -13,23 +14,63 @@ import (
 	_ "gopkg.in/doug-martin/goqu.v4/adapters/mysql"
 )
 
+var ErrVideoCourseChange = errors.New("a video can't be moved to another course")
+
 type Video struct {
-	ID          int64    `json:"id" filter:"id,number"`
-	Name        string   `json:"name" filter:"name,string"`
-	Description *string  `json:"description" filter:"description,string"`
-	Cover       *string  `json:"cover" filter:"-"`
-	Src         *string  `json:"src" filter:"-"`
-	Offline     bool     `json:"offline" filter:"offline,string"`
-	CourseID    int64    `json:"course_id" filter:"course,number"`
-	CreatedAt   string   `json:"created_at"  filter:"created_at,date"`
-	UpdatedAt   string   `json:"updated_at"  filter:"updated_at,date"`
-	Env         *env.Env `json:"-"`
+	ID          int64   `json:"id" filter:"id,number"`
+	Name        string  `json:"name" filter:"name,string"`
+	Description *string `json:"description" filter:"description,string"`
+	Cover       *string `json:"cover" filter:"-"`
+	Src         *string `json:"src" filter:"-"`
+	Offline     bool    `json:"offline" filter:"offline,string"`
+	// Public videos can be watched without enrolling, as a free preview.
+	Public    bool           `json:"public" filter:"public,string"`
+	CourseID  int64          `json:"course_id" filter:"course,number"`
+	SectionID *int64         `json:"section_id" filter:"section_id,number"`
+	Position  int            `json:"position" filter:"-"`
+	Duration  *int64         `json:"duration" filter:"duration,number"`
+	Status    string         `json:"status" filter:"status,string"`
+	PublishAt *time.Time     `json:"publish_at" filter:"publish_at,date"`
+	CreatedAt string         `json:"created_at"  filter:"created_at,date"`
+	UpdatedAt string         `json:"updated_at"  filter:"updated_at,date"`
+	DeletedAt *time.Time     `json:"deleted_at,omitempty" filter:"deleted_at,date"`
+	Progress  *VideoProgress `json:"progress,omitempty" filter:"-"`
+	// OnlyPublished limits listings to published videos of published courses,
+	// but for the courses InstructorID teaches.
+	OnlyPublished bool  `json:"-"`
+	InstructorID  int64 `json:"-"`
+	// Trash lists trashed videos instead of live ones.
+	Trash bool     `json:"-"`
+	Env   *env.Env `json:"-"`
 }
 
 func (video *Video) Get(p *pagination.Paginator, f *filter.Filter) ([]*Video, error) {
 	var videos []*Video
 
-	query := video.Env.QB.From(goqu.I("video")).Order(goqu.I("created_at").Desc()).Prepared(true)
+	query := video.Env.QB.From(goqu.I("video")).Select(
+		goqu.I("id"),
+		goqu.I("name"),
+		goqu.I("description"),
+		goqu.I("cover"),
+		goqu.I("src"),
+		goqu.I("offline"),
+		goqu.I("public"),
+		goqu.I("course_id"),
+		goqu.I("section_id"),
+		goqu.I("position"),
+		goqu.I("duration"),
+		goqu.I("status"),
+		goqu.I("publish_at"),
+		goqu.I("created_at"),
+		goqu.I("updated_at"),
+		goqu.I("deleted_at")).Where(trashed(video.Trash)).Order(goqu.I("created_at").Desc()).Prepared(true)
+	if !video.Trash {
+		query = query.Where(goqu.L("course_id IN (SELECT id FROM course WHERE deleted_at IS NULL)"))
+	}
+	if video.OnlyPublished {
+		query = query.Where(goqu.L("(("+visibleSQL("")+" AND course_id IN (SELECT id FROM course WHERE "+visibleSQL("")+")) "+
+			"OR course_id IN (SELECT course_id FROM course_instructor WHERE user_id = ?))", video.InstructorID))
+	}
 
 	p.PK = "id"
 	query = f.Filterize(query)
@@ -40,8 +81,8 @@ func (video *Video) Get(p *pagination.Paginator, f *filter.Filter) ([]*Video, er
 	rows, err := video.Env.DB.Query(sqlstring, args...)
 	defer rows.Close()
 	for rows.Next() {
-		c := new(Video)
-		if err := rows.Scan(&c.ID, &c.Name, &c.Description, &c.Cover, &c.Src, &c.Offline, &c.CourseID, &c.CreatedAt, &c.UpdatedAt); err != nil {
+		c := &Video{Env: video.Env}
+		if err := rows.Scan(&c.ID, &c.Name, &c.Description, &c.Cover, &c.Src, &c.Offline, &c.Public, &c.CourseID, &c.SectionID, &c.Position, &c.Duration, &c.Status, &c.PublishAt, &c.CreatedAt, &c.UpdatedAt, &c.DeletedAt); err != nil {
 			fmt.Printf("%+v\n", err)
 		}
 		videos = append(videos, c)
@@ -55,7 +96,7 @@ func (video *Video) Get(p *pagination.Paginator, f *filter.Filter) ([]*Video, er
 }
 func (video *Video) GetByID(ID int64) (*Video, error) {
 
-	err := video.Env.DB.QueryRow("SELECT id, name, description, cover, src, course_id,offline, created_at,updated_at FROM video where id = ? ", ID).Scan(&video.ID, &video.Name, &video.Description, &video.Cover, &video.Src, &video.CourseID, &video.Offline, &video.CreatedAt, &video.UpdatedAt)
+	err := video.Env.DB.QueryRow("SELECT id, name, description, cover, src, course_id, section_id, position, offline, public, duration, status, publish_at, created_at,updated_at FROM video where id = ? AND deleted_at IS NULL", ID).Scan(&video.ID, &video.Name, &video.Description, &video.Cover, &video.Src, &video.CourseID, &video.SectionID, &video.Position, &video.Offline, &video.Public, &video.Duration, &video.Status, &video.PublishAt, &video.CreatedAt, &video.UpdatedAt)
 	if err != nil {
 		return &Video{}, err
 	}
@@ -63,9 +104,19 @@ func (video *Video) GetByID(ID int64) (*Video, error) {
 
 }
 
+// Create appends the video to the end of its section, or of the course when
+// it has no section.
 func (video *Video) Create() (int64, error) {
+	if err := video.checkCourse(video.CourseID); err != nil {
+		return 0, err
+	}
+	if err := video.checkSection(video.CourseID); err != nil {
+		return 0, err
+	}
 
-	result, err := video.Env.DB.Exec("INSERT INTO video (`name`,`description`,`course_id`,`offline`) VALUES (?,?,?,?) ", &video.Name, &video.Description, &video.CourseID, &video.Offline)
+	result, err := video.Env.DB.Exec("INSERT INTO video (`name`,`description`,`course_id`,`section_id`,`position`,`offline`,`public`,`duration`) "+
+		"SELECT ?,?,?,?,COALESCE(MAX(position) + 1, 0),?,?,? FROM video WHERE course_id = ? AND section_id <=> ?",
+		&video.Name, &video.Description, &video.CourseID, &video.SectionID, &video.Offline, &video.Public, &video.Duration, &video.CourseID, &video.SectionID)
 
 	if err != nil {
 		return 0, err
@@ -100,20 +151,101 @@ func (video *Video) UpdateSrc() error {
 	return err
 }
 
+// Update keeps the video in its course. Moving it to another section puts
+// it at the end of that section.
 func (video *Video) Update() error {
-	sql, err := video.Env.DB.Prepare("UPDATE video SET `name` = ?, `description` = ?,`offline` = ?  WHERE id=?")
+	current := &Video{Env: video.Env}
+	if _, err := current.GetByID(video.ID); err != nil {
+		return err
+	}
+	if video.CourseID != 0 && video.CourseID != current.CourseID {
+		return ErrVideoCourseChange
+	}
+	if err := video.checkCourse(current.CourseID); err != nil {
+		return err
+	}
+	if err := video.checkSection(current.CourseID); err != nil {
+		return err
+	}
+
+	sql, err := video.Env.DB.Prepare("UPDATE video v, (SELECT COALESCE(MAX(position) + 1, 0) AS next FROM video WHERE course_id = ? AND section_id <=> ? AND id <> ?) n " +
+		"SET v.`name` = ?, v.`description` = ?, v.`offline` = ?, v.`public` = ?, v.`duration` = ?, v.`position` = IF(v.section_id <=> ?, v.position, n.next), v.`section_id` = ? WHERE v.id = ?")
 	if err != nil {
 		return err
 	}
-	_, err = sql.Exec(&video.Name, &video.Description, &video.Offline, &video.ID)
+	_, err = sql.Exec(current.CourseID, &video.SectionID, &video.ID, &video.Name, &video.Description, &video.Offline, &video.Public, &video.Duration, &video.SectionID, &video.SectionID, &video.ID)
 
 	return err
 }
-func (video *Video) Delete() error {
-	sql, err := video.Env.DB.Prepare("DELETE FROM video WHERE id=?")
+
+// IsVisible tells whether the video itself is published, the course has to
+// be checked separately.
+func (video *Video) IsVisible() bool {
+	return isVisible(video.Status, video.PublishAt)
+}
+
+// IsAvailable tells whether both the video and its course are visible to
+// non-admins.
+func (video *Video) IsAvailable() (bool, error) {
+	if !video.IsVisible() {
+		return false, nil
+	}
+	course := &Course{Env: video.Env}
+	course, err := course.GetByID(video.CourseID)
+	if err == sql.ErrNoRows {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	return course.IsVisible(), nil
+}
+
+func (video *Video) ChangeStatus(t *Transition) error {
+	return changeStatus(video.Env.DB, "video", video.ID, t)
+}
+
+func (video *Video) checkCourse(courseID int64) error {
+	course := &Course{Env: video.Env}
+	exists, err := course.Exists(courseID)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return ErrCourseNotFound
+	}
+	return nil
+}
+
+func (video *Video) checkSection(courseID int64) error {
+	if video.SectionID == nil {
+		return nil
+	}
+	section := &Section{Env: video.Env}
+	section, err := section.GetByID(*video.SectionID)
 	if err != nil {
 		return err
 	}
-	_, err = sql.Exec(&video.ID)
+	if section.CourseID != courseID {
+		return ErrSectionNotInCourse
+	}
+	return nil
+}
+
+// Delete moves the video to the trash, Purger removes it and its files for good.
+func (video *Video) Delete() error {
+	return softDelete(video.Env.DB, "video", video.ID)
+}
+
+func (video *Video) Restore() error {
+	return restore(video.Env.DB, "video", video.ID)
+}
+
+// SetDuration stores the duration reported by an admin's player, unless it
+// is already known.
+func (video *Video) SetDuration(duration int64) error {
+	_, err := video.Env.DB.Exec("UPDATE video SET duration = ? WHERE id = ? AND duration IS NULL", duration, &video.ID)
+	if err == nil && video.Duration == nil {
+		video.Duration = &duration
+	}
 	return err
 }
@@ -0,0 +1,22 @@
+package model
+
+import "github.com/arizanovj/courses/env"
+
+// VideoView records a playback started through the stream endpoint.
+type VideoView struct {
+	ID        int64    `json:"id"`
+	VideoID   int64    `json:"video_id"`
+	UserID    *int64   `json:"user_id"`
+	IP        string   `json:"ip"`
+	UserAgent string   `json:"user_agent"`
+	CreatedAt string   `json:"created_at"`
+	Env       *env.Env `json:"-"`
+}
+
+func (view *VideoView) Log() error {
+	if len(view.UserAgent) > 255 {
+		view.UserAgent = view.UserAgent[:255]
+	}
+	_, err := view.Env.DB.Exec("INSERT INTO video_view (`video_id`,`user_id`,`ip`,`user_agent`) VALUES (?,?,?,?)", view.VideoID, view.UserID, view.IP, view.UserAgent)
+	return err
+}
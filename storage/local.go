@@ -0,0 +1,97 @@
+package storage
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"time"
+)
+
+// Local keeps objects as files under Dir.
+type Local struct {
+	Dir string
+}
+
+func (l *Local) Put(key string, r io.Reader, size int64, contentType string) error {
+	name := l.path(key)
+	if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+		return err
+	}
+	// written next to its final name and renamed over it once complete
+	file, err := ioutil.TempFile(filepath.Dir(name), ".put_")
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(file, r)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Chmod(file.Name(), 0644)
+	}
+	if err == nil {
+		err = os.Rename(file.Name(), name)
+	}
+	if err != nil {
+		os.Remove(file.Name())
+	}
+	return err
+}
+
+func (l *Local) Get(key string) (Reader, *Object, error) {
+	file, err := os.Open(l.path(key))
+	if os.IsNotExist(err) {
+		return nil, nil, ErrNotFound
+	} else if err != nil {
+		return nil, nil, err
+	}
+	info, err := file.Stat()
+	if err == nil && info.IsDir() {
+		err = ErrNotFound
+	}
+	if err != nil {
+		file.Close()
+		return nil, nil, err
+	}
+	return file, localObject(key, info), nil
+}
+
+func (l *Local) Delete(key string) error {
+	err := os.Remove(l.path(key))
+	if os.IsNotExist(err) {
+		return ErrNotFound
+	}
+	return err
+}
+
+func (l *Local) Stat(key string) (*Object, error) {
+	info, err := os.Stat(l.path(key))
+	if os.IsNotExist(err) || (err == nil && info.IsDir()) {
+		return nil, ErrNotFound
+	} else if err != nil {
+		return nil, err
+	}
+	return localObject(key, info), nil
+}
+
+// URL is always empty, files on the local disk are served by the app.
+func (l *Local) URL(key string, ttl time.Duration) (string, error) {
+	return "", nil
+}
+
+// path keeps keys with .. elements inside Dir.
+func (l *Local) path(key string) string {
+	return filepath.Join(l.Dir, filepath.FromSlash(path.Clean("/"+key)))
+}
+
+func localObject(key string, info os.FileInfo) *Object {
+	return &Object{
+		Key:     key,
+		Size:    info.Size(),
+		ModTime: info.ModTime(),
+		ETag:    fmt.Sprintf("\"%x-%x\"", info.ModTime().UnixNano(), info.Size()),
+	}
+}
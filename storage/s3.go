@@ -0,0 +1,408 @@
+package storage
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	unsignedPayload = "UNSIGNED-PAYLOAD"
+	// maxPutSize is the most S3 takes in a single PUT, larger objects are
+	// sent in parts.
+	maxPutSize = 5 << 30
+	maxParts   = 10000
+)
+
+// S3 keeps objects in a bucket of an S3 compatible service, AWS or a MinIO
+// running locally. Requests are signed with AWS Signature Version 4 and use
+// path style urls, Endpoint/Bucket/key, which every such service accepts.
+type S3 struct {
+	Endpoint  string
+	Region    string
+	Bucket    string
+	AccessKey string
+	SecretKey string
+	// PartSize is the size of the parts objects over PartSize are uploaded
+	// in, 64MB when zero. S3 wants at least 5MB.
+	PartSize int64
+	Client   *http.Client
+}
+
+func (s *S3) Put(key string, r io.Reader, size int64, contentType string) error {
+	partSize := s.PartSize
+	if partSize == 0 {
+		partSize = 64 << 20
+	}
+	if partSize > maxPutSize {
+		partSize = maxPutSize
+	}
+	if size > partSize {
+		return s.putMultipart(key, r, size, partSize, contentType)
+	}
+
+	req, err := http.NewRequest("PUT", s.objectURL(key), r)
+	if err != nil {
+		return err
+	}
+	// the body is sent as it is read, http.Request needs its length to not
+	// fall back to chunked encoding which S3 refuses
+	req.ContentLength = size
+	if size == 0 {
+		req.Body = http.NoBody
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	resp, err := s.do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// putMultipart uploads the object in parts of partSize, or as many bytes as
+// it takes to stay within maxParts. The parts are dropped on failure.
+func (s *S3) putMultipart(key string, r io.Reader, size int64, partSize int64, contentType string) error {
+	if least := (size + maxParts - 1) / maxParts; partSize < least {
+		partSize = least
+	}
+
+	req, err := http.NewRequest("POST", s.objectURL(key)+"?uploads", nil)
+	if err != nil {
+		return err
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	resp, err := s.do(req)
+	if err != nil {
+		return err
+	}
+	initiated := struct {
+		UploadID string `xml:"UploadId"`
+	}{}
+	err = xml.NewDecoder(resp.Body).Decode(&initiated)
+	resp.Body.Close()
+	if err != nil {
+		return err
+	}
+	uploadURL := s.objectURL(key) + "?uploadId=" + url.QueryEscape(initiated.UploadID)
+
+	err = s.putParts(uploadURL, r, size, partSize)
+	if err != nil {
+		if req, abortErr := http.NewRequest("DELETE", uploadURL, nil); abortErr == nil {
+			if resp, abortErr := s.do(req); abortErr == nil {
+				resp.Body.Close()
+			}
+		}
+	}
+	return err
+}
+
+type completedPart struct {
+	PartNumber int
+	ETag       string
+}
+
+func (s *S3) putParts(uploadURL string, r io.Reader, size int64, partSize int64) error {
+	var parts []completedPart
+	for offset, number := int64(0), 1; offset < size; offset, number = offset+partSize, number+1 {
+		length := partSize
+		if size-offset < length {
+			length = size - offset
+		}
+		req, err := http.NewRequest("PUT", uploadURL+"&partNumber="+strconv.Itoa(number), io.LimitReader(r, length))
+		if err != nil {
+			return err
+		}
+		req.ContentLength = length
+		resp, err := s.do(req)
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+		parts = append(parts, completedPart{PartNumber: number, ETag: resp.Header.Get("ETag")})
+	}
+
+	body, err := xml.Marshal(struct {
+		XMLName xml.Name        `xml:"CompleteMultipartUpload"`
+		Parts   []completedPart `xml:"Part"`
+	}{Parts: parts})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest("POST", uploadURL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	resp, err := s.do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	// a failed completion may still come with 200, the error in the body
+	result := struct {
+		XMLName xml.Name
+		Code    string
+		Message string
+	}{}
+	if err := xml.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return err
+	}
+	if result.XMLName.Local == "Error" {
+		return fmt.Errorf("s3: completing upload: %s %s", result.Code, result.Message)
+	}
+	return nil
+}
+
+// Get doesn't download anything yet, the returned Reader fetches the object
+// from wherever it was last seeked to with ranged requests.
+func (s *S3) Get(key string) (Reader, *Object, error) {
+	object, err := s.Stat(key)
+	if err != nil {
+		return nil, nil, err
+	}
+	return &s3Reader{s: s, object: object}, object, nil
+}
+
+func (s *S3) Delete(key string) error {
+	if _, err := s.Stat(key); err != nil {
+		return err
+	}
+	req, err := http.NewRequest("DELETE", s.objectURL(key), nil)
+	if err != nil {
+		return err
+	}
+	resp, err := s.do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+func (s *S3) Stat(key string) (*Object, error) {
+	req, err := http.NewRequest("HEAD", s.objectURL(key), nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := s.do(req)
+	if err != nil {
+		return nil, err
+	}
+	resp.Body.Close()
+
+	object := &Object{
+		Key:         key,
+		Size:        resp.ContentLength,
+		ETag:        resp.Header.Get("ETag"),
+		ContentType: resp.Header.Get("Content-Type"),
+	}
+	if modified, err := http.ParseTime(resp.Header.Get("Last-Modified")); err == nil {
+		object.ModTime = modified
+	}
+	return object, nil
+}
+
+// URL presigns a GET of the object, S3 caps ttl at seven days.
+func (s *S3) URL(key string, ttl time.Duration) (string, error) {
+	u, err := url.Parse(s.objectURL(key))
+	if err != nil {
+		return "", err
+	}
+	now := time.Now().UTC()
+	query := url.Values{}
+	query.Set("X-Amz-Algorithm", "AWS4-HMAC-SHA256")
+	query.Set("X-Amz-Credential", s.AccessKey+"/"+s.scope(now))
+	query.Set("X-Amz-Date", now.Format("20060102T150405Z"))
+	query.Set("X-Amz-Expires", strconv.Itoa(int(ttl.Seconds())))
+	query.Set("X-Amz-SignedHeaders", "host")
+
+	canonical := strings.Join([]string{
+		"GET",
+		u.EscapedPath(),
+		canonicalQuery(query),
+		"host:" + u.Host + "\n",
+		"host",
+		unsignedPayload,
+	}, "\n")
+	query.Set("X-Amz-Signature", s.signature(now, canonical))
+	u.RawQuery = canonicalQuery(query)
+	return u.String(), nil
+}
+
+// do signs and sends req, statuses other than 2xx are turned into errors.
+func (s *S3) do(req *http.Request) (*http.Response, error) {
+	now := time.Now().UTC()
+	req.Header.Set("X-Amz-Date", now.Format("20060102T150405Z"))
+	req.Header.Set("X-Amz-Content-Sha256", unsignedPayload)
+
+	signed := []string{"host", "x-amz-content-sha256", "x-amz-date"}
+	canonical := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		canonicalQuery(req.URL.Query()),
+		"host:" + req.URL.Host + "\n" +
+			"x-amz-content-sha256:" + unsignedPayload + "\n" +
+			"x-amz-date:" + req.Header.Get("X-Amz-Date") + "\n",
+		strings.Join(signed, ";"),
+		unsignedPayload,
+	}, "\n")
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s.AccessKey, s.scope(now), strings.Join(signed, ";"), s.signature(now, canonical)))
+
+	client := s.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode == http.StatusNotFound {
+		resp.Body.Close()
+		return nil, ErrNotFound
+	}
+	if resp.StatusCode/100 != 2 {
+		body, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1024))
+		resp.Body.Close()
+		return nil, fmt.Errorf("s3: %s %s: %s %s", req.Method, req.URL.Path, resp.Status, body)
+	}
+	return resp, nil
+}
+
+func (s *S3) objectURL(key string) string {
+	return strings.TrimRight(s.Endpoint, "/") + "/" + s.Bucket + "/" + escapePath(strings.TrimLeft(key, "/"))
+}
+
+func (s *S3) scope(t time.Time) string {
+	return t.Format("20060102") + "/" + s.Region + "/s3/aws4_request"
+}
+
+func (s *S3) signature(t time.Time, canonicalRequest string) string {
+	hash := sha256.Sum256([]byte(canonicalRequest))
+	toSign := "AWS4-HMAC-SHA256\n" + t.Format("20060102T150405Z") + "\n" + s.scope(t) + "\n" + hex.EncodeToString(hash[:])
+
+	key := hmacSHA256([]byte("AWS4"+s.SecretKey), t.Format("20060102"))
+	key = hmacSHA256(key, s.Region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	return hex.EncodeToString(hmacSHA256(key, toSign))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// canonicalQuery sorts the parameters and escapes them the way SigV4 does,
+// spaces as %20 rather than +.
+func canonicalQuery(query url.Values) string {
+	keys := make([]string, 0, len(query))
+	for key := range query {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	var pairs []string
+	for _, key := range keys {
+		values := query[key]
+		sort.Strings(values)
+		for _, value := range values {
+			pairs = append(pairs, escape(key)+"="+escape(value))
+		}
+	}
+	return strings.Join(pairs, "&")
+}
+
+func escapePath(key string) string {
+	segments := strings.Split(key, "/")
+	for i, segment := range segments {
+		segments[i] = escape(segment)
+	}
+	return strings.Join(segments, "/")
+}
+
+func escape(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if 'A' <= c && c <= 'Z' || 'a' <= c && c <= 'z' || '0' <= c && c <= '9' || c == '-' || c == '_' || c == '.' || c == '~' {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+type s3Reader struct {
+	s      *S3
+	object *Object
+	offset int64
+	body   io.ReadCloser
+}
+
+func (r *s3Reader) Read(p []byte) (int, error) {
+	if r.offset >= r.object.Size {
+		return 0, io.EOF
+	}
+	if r.body == nil {
+		req, err := http.NewRequest("GET", r.s.objectURL(r.object.Key), nil)
+		if err != nil {
+			return 0, err
+		}
+		req.Header.Set("Range", "bytes="+strconv.FormatInt(r.offset, 10)+"-")
+		// a replaced object must not be mixed with what was read of the old one
+		if r.object.ETag != "" {
+			req.Header.Set("If-Match", r.object.ETag)
+		}
+		resp, err := r.s.do(req)
+		if err != nil {
+			return 0, err
+		}
+		r.body = resp.Body
+	}
+	n, err := r.body.Read(p)
+	r.offset += int64(n)
+	return n, err
+}
+
+func (r *s3Reader) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekCurrent:
+		offset += r.offset
+	case io.SeekEnd:
+		offset += r.object.Size
+	}
+	if offset < 0 {
+		return 0, fmt.Errorf("s3: seeking to negative offset %d", offset)
+	}
+	if offset != r.offset {
+		r.Close()
+		r.offset = offset
+	}
+	return offset, nil
+}
+
+func (r *s3Reader) Close() error {
+	if r.body == nil {
+		return nil
+	}
+	err := r.body.Close()
+	r.body = nil
+	return err
+}
@@ -0,0 +1,38 @@
+package storage
+
+import (
+	"errors"
+	"io"
+	"time"
+)
+
+var ErrNotFound = errors.New("there is no such object")
+
+// Object describes a stored file.
+type Object struct {
+	Key         string
+	Size        int64
+	ModTime     time.Time
+	ETag        string
+	ContentType string
+}
+
+// Reader is an open stored file, it seeks so ranges can be served from it.
+type Reader interface {
+	io.ReadSeeker
+	io.Closer
+}
+
+// Storage keeps the media files, covers and videos, under slash separated
+// keys such as "static/image/course_cover_1a2b.png".
+type Storage interface {
+	// Put stores size bytes of r under key, replacing whatever was there.
+	// Readers of key never see a partly written file.
+	Put(key string, r io.Reader, size int64, contentType string) error
+	Get(key string) (Reader, *Object, error)
+	Delete(key string) error
+	Stat(key string) (*Object, error)
+	// URL is a link clients can fetch the object from directly for ttl, it
+	// is empty when the backend can't serve files itself and the app has to.
+	URL(key string, ttl time.Duration) (string, error)
+}